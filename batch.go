@@ -0,0 +1,209 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/cloudfoundry/bosh-gcscli/client"
+	"github.com/cloudfoundry/bosh-gcscli/config"
+)
+
+// batchOperation is a single line of a batch manifest.
+type batchOperation struct {
+	// Op is one of put, get, delete, exists or copy.
+	Op string `json:"op"`
+	// Src is the local file for put, the blob for get and copy.
+	Src string `json:"src,omitempty"`
+	// Dst is the blob for put and copy, the local file for get.
+	Dst string `json:"dst,omitempty"`
+	// Blob is the blob for delete and exists.
+	Blob string `json:"blob,omitempty"`
+}
+
+// batchResult reports the outcome of the operation on line Line.
+type batchResult struct {
+	Line       int    `json:"line"`
+	Op         string `json:"op"`
+	Status     string `json:"status"`
+	Exists     *bool  `json:"exists,omitempty"`
+	ReadPath   string `json:"read_path,omitempty"`
+	ErrorCode  string `json:"error_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+const (
+	statusOK      = "ok"
+	statusFailed  = "failed"
+	statusSkipped = "skipped"
+)
+
+// errInvalidOperation is returned for manifest lines which cannot be executed.
+var errInvalidOperation = errors.New("invalid operation")
+
+// runBatch executes the NDJSON operations read from a file, or stdin,
+// concurrently on a single client and writes one NDJSON result per
+// operation to stdout.
+func runBatch(ctx context.Context, cfg *config.GCSCli, args []string) error {
+	flags := flag.NewFlagSet("batch", flag.ExitOnError)
+	parallelism := flags.Int("parallelism", 8, "maximum number of concurrent operations")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *parallelism < 1 {
+		return errors.New("--parallelism must be at least 1")
+	}
+	if flags.NArg() > 1 {
+		return fmt.Errorf("batch expected at most 1 argument got %d", flags.NArg())
+	}
+
+	manifest := io.Reader(os.Stdin)
+	if path := flags.Arg(0); path != "" && path != "-" {
+		manifestFile, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer manifestFile.Close() //nolint:errcheck
+		manifest = manifestFile
+	}
+
+	blobstoreClient, err := client.New(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("creating gcs client: %v", err)
+	}
+
+	var (
+		outputMu sync.Mutex
+		output   = json.NewEncoder(os.Stdout)
+		total    int
+		failed   int
+	)
+
+	group := new(errgroup.Group)
+	group.SetLimit(*parallelism)
+
+	scanner := bufio.NewScanner(manifest)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		total++
+
+		var op batchOperation
+		decodeErr := json.Unmarshal(scanner.Bytes(), &op)
+
+		group.Go(func() error {
+			start := time.Now()
+			result := batchResult{Line: line, Op: op.Op, Status: statusOK}
+
+			var err error
+			if decodeErr != nil {
+				err = fmt.Errorf("%w: %v", errInvalidOperation, decodeErr)
+			} else {
+				err = executeBatchOperation(blobstoreClient, op, cfg.SkipIfIdentical, &result)
+			}
+			result.DurationMS = time.Since(start).Milliseconds()
+
+			outputMu.Lock()
+			defer outputMu.Unlock()
+			if err != nil {
+				failed++
+				result.Status = statusFailed
+				result.ErrorCode = errorCode(err)
+				result.Error = err.Error()
+			}
+			return output.Encode(result)
+		})
+	}
+
+	if err := group.Wait(); err != nil {
+		return fmt.Errorf("writing results: %v", err)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading manifest: %v", err)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d operations failed", failed, total)
+	}
+	return nil
+}
+
+// executeBatchOperation performs op, recording in result whether the blob
+// exists for exists operations, the read path of get and exists, and
+// whether puts were skipped as their blob is identical if skipIfIdentical.
+func executeBatchOperation(blobstoreClient *client.GCSBlobstore, op batchOperation, skipIfIdentical bool, result *batchResult) error {
+	switch op.Op {
+	case "put":
+		if op.Src == "" || op.Dst == "" {
+			return fmt.Errorf("%w: put requires src and dst", errInvalidOperation)
+		}
+		sourceFile, err := os.Open(op.Src)
+		if err != nil {
+			return err
+		}
+		defer sourceFile.Close() //nolint:errcheck
+		skipped, err := blobstoreClient.PutWithResult(sourceFile, op.Dst, client.PutOptions{SkipIfIdentical: skipIfIdentical})
+		if skipped {
+			result.Status = statusSkipped
+		}
+		return err
+	case "get":
+		if op.Src == "" || op.Dst == "" {
+			return fmt.Errorf("%w: get requires src and dst", errInvalidOperation)
+		}
+		return downloadFile(op.Dst, func(w io.Writer) error {
+			readPath, err := blobstoreClient.GetWithReadPath(op.Src, w)
+			result.ReadPath = readPath
+			return err
+		})
+	case "delete":
+		if op.Blob == "" {
+			return fmt.Errorf("%w: delete requires blob", errInvalidOperation)
+		}
+		return blobstoreClient.Delete(op.Blob)
+	case "exists":
+		if op.Blob == "" {
+			return fmt.Errorf("%w: exists requires blob", errInvalidOperation)
+		}
+		exists, readPath, err := blobstoreClient.ExistsWithReadPath(op.Blob)
+		if err != nil {
+			return err
+		}
+		result.Exists, result.ReadPath = &exists, readPath
+		return nil
+	case "copy":
+		if op.Src == "" || op.Dst == "" {
+			return fmt.Errorf("%w: copy requires src and dst", errInvalidOperation)
+		}
+		return blobstoreClient.Copy(op.Src, op.Dst)
+	default:
+		return fmt.Errorf("%w: unknown op '%s'", errInvalidOperation, op.Op)
+	}
+}
@@ -0,0 +1,186 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"cloud.google.com/go/storage"
+
+	"github.com/cloudfoundry/bosh-gcscli/client"
+	"github.com/cloudfoundry/bosh-gcscli/config"
+)
+
+// runBucket performs the bucket-level operation named by args[0].
+func runBucket(ctx context.Context, cfg *config.GCSCli, args []string) error {
+	if len(args) == 0 {
+		return errors.New("bucket expected an operation")
+	}
+
+	switch args[0] {
+	case "lifecycle":
+		return runBucketLifecycle(ctx, cfg, args[1:])
+	case "create", "ensure":
+		return runBucketProvision(ctx, cfg, args[0], args[1:])
+	case "delete":
+		return runBucketDelete(ctx, cfg, args[1:])
+	default:
+		return fmt.Errorf("unknown bucket operation: '%s'", args[0])
+	}
+}
+
+// runBucketLifecycle prints, replaces or clears the lifecycle
+// configuration of the bucket.
+func runBucketLifecycle(ctx context.Context, cfg *config.GCSCli, args []string) error {
+	if len(args) == 0 {
+		return errors.New("bucket lifecycle expected 'get', 'set' or 'clear'")
+	}
+
+	var lifecycle storage.Lifecycle
+	switch {
+	case args[0] == "get" && len(args) == 1:
+	case args[0] == "clear" && len(args) == 1:
+	case args[0] == "set" && len(args) == 2:
+		// Rules are validated before creating a client so that mistakes
+		// are reported without touching the bucket
+		data, err := os.ReadFile(args[1])
+		if err != nil {
+			return err
+		}
+		if lifecycle, err = client.ParseLifecycle(data); err != nil {
+			return fmt.Errorf("reading %s: %w", args[1], err)
+		}
+	default:
+		return errors.New("bucket lifecycle expected 'get', 'set <path/to/lifecycle.json>' or 'clear'")
+	}
+
+	blobstoreClient, err := client.New(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("creating gcs client: %v", err)
+	}
+
+	if args[0] != "get" {
+		return blobstoreClient.SetLifecycle(lifecycle)
+	}
+
+	if lifecycle, err = blobstoreClient.Lifecycle(); err != nil {
+		return err
+	}
+	data, err := client.MarshalLifecycle(lifecycle)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(os.Stdout, string(data))
+	return err
+}
+
+// bucketResult is the JSON output of bucket create, ensure and delete.
+type bucketResult struct {
+	Bucket string `json:"bucket"`
+	Status string `json:"status"`
+}
+
+// writeBucketResult prints that the bucket operation had outcome status.
+func writeBucketResult(bucket, status string) {
+	if *outputFormat != outputJSON {
+		fmt.Printf("Bucket '%s' %s\n", bucket, status)
+		return
+	}
+	if err := json.NewEncoder(os.Stdout).Encode(bucketResult{Bucket: bucket, Status: status}); err != nil {
+		log.Printf("writing result: %v\n", err)
+	}
+}
+
+// runBucketProvision creates the bucket, or with ensure, creates it if it
+// is missing and otherwise updates the settings given as flags.
+func runBucketProvision(ctx context.Context, cfg *config.GCSCli, operation string, args []string) error {
+	flags := flag.NewFlagSet("bucket "+operation, flag.ExitOnError)
+	project := flags.String("project", "", "project to create the bucket in\n(optional, defaults to the project of the credentials or $"+client.ProjectEnv+")")
+	location := flags.String("location", "", "location of the bucket, e.g. 'us-east1' or 'US' (optional, defaults to '"+client.DefaultBucketLocation+"')")
+	storageClass := flags.String("storage-class", cfg.StorageClass, "default storage class of the bucket\n(optional, defaults to storage_class in the config)")
+	uniformAccess := flags.Bool("uniform-access", false, "enable uniform bucket-level access")
+	versioning := flags.Bool("versioning", false, "enable object versioning")
+	publicRead := flags.Bool("public-read", false, "grant everyone read access to the objects of the bucket")
+	args, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 0 {
+		return fmt.Errorf("bucket %s expected no arguments got %d", operation, len(args))
+	}
+
+	// Boolean settings not given are left as they are by ensure
+	settings := client.BucketSettings{Project: *project, Location: *location, StorageClass: *storageClass}
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "uniform-access":
+			settings.UniformAccess = uniformAccess
+		case "versioning":
+			settings.Versioning = versioning
+		case "public-read":
+			settings.PublicRead = publicRead
+		}
+	})
+
+	blobstoreClient, err := client.New(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("creating gcs client: %v", err)
+	}
+
+	status := client.BucketCreated
+	if operation == "ensure" {
+		status, err = blobstoreClient.EnsureBucket(settings)
+	} else {
+		err = blobstoreClient.CreateBucket(settings)
+	}
+	if err != nil {
+		return err
+	}
+	writeBucketResult(cfg.BucketName, status)
+	return nil
+}
+
+// runBucketDelete deletes the bucket, succeeding if it does not exist.
+func runBucketDelete(ctx context.Context, cfg *config.GCSCli, args []string) error {
+	flags := flag.NewFlagSet("bucket delete", flag.ExitOnError)
+	force := flags.Bool("force", false, "delete every object, including noncurrent versions, before the bucket")
+	args, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 0 {
+		return fmt.Errorf("bucket delete expected no arguments got %d", len(args))
+	}
+
+	blobstoreClient, err := client.New(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("creating gcs client: %v", err)
+	}
+
+	status, err := blobstoreClient.DeleteBucket(*force)
+	if err != nil {
+		return err
+	}
+	writeBucketResult(cfg.BucketName, status)
+	return nil
+}
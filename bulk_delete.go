@@ -0,0 +1,190 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/cloudfoundry/bosh-gcscli/client"
+	"github.com/cloudfoundry/bosh-gcscli/config"
+)
+
+// deleteResult reports the outcome of deleting a single blob.
+type deleteResult struct {
+	Object     string `json:"object"`
+	Status     string `json:"status"`
+	ErrorCode  string `json:"error_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms,omitempty"`
+}
+
+// statusPlanned is reported for blobs which a dry run would delete.
+const statusPlanned = "planned"
+
+// bulkDeleteFlags are the flags of runBulkDelete, which select it over the
+// deletion of a single blob.
+var bulkDeleteFlags = []string{"prefix", "from-file", "yes", "max-objects", "dry-run", "parallelism", "h", "help"}
+
+// isBulkDeleteFlag reports whether arg is one of bulkDeleteFlags, as
+// -name, --name or with =value.
+func isBulkDeleteFlag(arg string) bool {
+	if !strings.HasPrefix(arg, "-") || arg == "--" {
+		return false
+	}
+	name, _, _ := strings.Cut(strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-"), "=")
+	return slices.Contains(bulkDeleteFlags, name)
+}
+
+// runBulkDelete deletes every blob below a prefix or listed in a file,
+// concurrently, and writes one NDJSON result per blob to stdout.
+func runBulkDelete(ctx context.Context, cfg *config.GCSCli, args []string) error {
+	flags := flag.NewFlagSet("delete", flag.ExitOnError)
+	prefix := flags.String("prefix", "", "delete every blob whose name starts with prefix")
+	fromFile := flags.String("from-file", "", "delete every blob named in the file, one per line ('-' for stdin)")
+	yes := flags.Bool("yes", false, "delete without a limit on the number of blobs")
+	maxObjects := flags.Int("max-objects", 0, "refuse to delete anything if more blobs match")
+	dryRun := flags.Bool("dry-run", false, "print the blobs which would be deleted")
+	parallelism := flags.Int("parallelism", 8, "maximum number of concurrent deletions")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	switch {
+	case flags.NArg() != 0:
+		return fmt.Errorf("delete expected no arguments besides flags got %d", flags.NArg())
+	case (*prefix == "") == (*fromFile == ""):
+		return errors.New("delete expects exactly one of --prefix or --from-file")
+	case !*yes && *maxObjects <= 0 && !*dryRun:
+		return errors.New("delete expects --yes or --max-objects to remove many blobs")
+	case *parallelism < 1:
+		return errors.New("--parallelism must be at least 1")
+	}
+
+	blobstoreClient, err := client.New(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("creating gcs client: %v", err)
+	}
+	if blobstoreClient.ReadOnly() && !*dryRun {
+		return client.ErrInvalidROWriteOperation
+	}
+
+	var objects []string
+	if *prefix != "" {
+		objects, err = listObjectNames(blobstoreClient, *prefix)
+	} else {
+		objects, err = readObjectNames(*fromFile)
+	}
+	if err != nil {
+		return err
+	}
+
+	if *maxObjects > 0 && len(objects) > *maxObjects {
+		return fmt.Errorf("%d blobs match, exceeding --max-objects %d", len(objects), *maxObjects)
+	}
+
+	output := json.NewEncoder(os.Stdout)
+	if *dryRun {
+		for _, object := range objects {
+			if err := output.Encode(deleteResult{Object: object, Status: statusPlanned}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var (
+		outputMu sync.Mutex
+		failed   int
+	)
+
+	group := new(errgroup.Group)
+	group.SetLimit(*parallelism)
+	for _, object := range objects {
+		group.Go(func() error {
+			start := time.Now()
+			err := blobstoreClient.Delete(object)
+			result := deleteResult{Object: object, Status: statusOK, DurationMS: time.Since(start).Milliseconds()}
+
+			outputMu.Lock()
+			defer outputMu.Unlock()
+			if err != nil {
+				failed++
+				result.Status = statusFailed
+				result.ErrorCode = errorCode(err)
+				result.Error = err.Error()
+			}
+			return output.Encode(result)
+		})
+	}
+
+	if err := group.Wait(); err != nil {
+		return fmt.Errorf("writing results: %v", err)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d deletions failed", failed, len(objects))
+	}
+	return nil
+}
+
+func listObjectNames(blobstoreClient *client.GCSBlobstore, prefix string) ([]string, error) {
+	blobs, err := blobstoreClient.List(prefix)
+	if err != nil {
+		return nil, fmt.Errorf("listing '%s': %v", prefix, err)
+	}
+
+	names := make([]string, 0, len(blobs))
+	for _, blob := range blobs {
+		names = append(names, blob.Name)
+	}
+	return names, nil
+}
+
+// readObjectNames reads one blob name per non-empty line of the file at p,
+// or of stdin if p is '-'.
+func readObjectNames(p string) ([]string, error) {
+	reader := io.Reader(os.Stdin)
+	if p != "-" {
+		f, err := os.Open(p)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close() //nolint:errcheck
+		reader = f
+	}
+
+	var names []string
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		if name := strings.TrimSpace(scanner.Text()); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, scanner.Err()
+}
@@ -0,0 +1,168 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/compute/metadata"
+	"cloud.google.com/go/storage"
+	"golang.org/x/oauth2/google"
+
+	"github.com/cloudfoundry/bosh-gcscli/config"
+)
+
+// auditedOperations are the operations recorded in the audit log.
+var auditedOperations = map[string]bool{"put": true, "delete": true, "copy": true, "sign": true, "delete-bucket": true}
+
+// auditRecord is a line of the audit log.
+type auditRecord struct {
+	Time      time.Time `json:"time"`
+	Principal string    `json:"principal,omitempty"`
+	Operation string    `json:"operation"`
+	Bucket    string    `json:"bucket"`
+	Object    string    `json:"object"`
+	// Source is the object copied from
+	Source string `json:"source,omitempty"`
+	// GenerationBefore is the generation of the object replaced or
+	// deleted, zero if there was none
+	GenerationBefore int64 `json:"generation_before,omitempty"`
+	// GenerationAfter is the generation of the object written
+	GenerationAfter int64  `json:"generation_after,omitempty"`
+	CRC32C          string `json:"crc32c,omitempty"`
+	// SignedURLMethod and SignedURLExpiry describe a signed url
+	SignedURLMethod string     `json:"signed_url_method,omitempty"`
+	SignedURLExpiry *time.Time `json:"signed_url_expiry,omitempty"`
+	Outcome         string     `json:"outcome"`
+	Error           string     `json:"error,omitempty"`
+}
+
+// auditLog appends the records of mutating operations to the audit_log
+// file, locking it so that concurrent processes can share it.
+type auditLog struct {
+	path      string
+	principal func() string
+}
+
+// newAuditLog returns the audit log of cfg, nil if audit_log is not set.
+func newAuditLog(cfg *config.GCSCli) *auditLog {
+	if cfg.AuditLog == "" {
+		return nil
+	}
+	return &auditLog{
+		path: cfg.AuditLog,
+		principal: sync.OnceValue(func() string {
+			return credentialsEmail(context.Background(), cfg)
+		}),
+	}
+}
+
+// append writes record as a line of the audit log. Failures are logged, as
+// the operation was already performed.
+func (l *auditLog) append(record auditRecord) {
+	record.Principal = l.principal()
+	line, err := json.Marshal(record)
+	if err != nil {
+		log.Printf("writing audit log: %v\n", err)
+		return
+	}
+
+	if err := appendLocked(l.path, append(line, '\n')); err != nil {
+		log.Printf("writing audit log %s: %v\n", l.path, err)
+	}
+}
+
+// appendLocked appends data to the file at path while holding an
+// exclusive lock on it.
+func appendLocked(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close() //nolint:errcheck
+
+	if err := lockFile(file); err != nil {
+		return fmt.Errorf("locking: %v", err)
+	}
+	defer unlockFile(file) //nolint:errcheck
+
+	_, err = file.Write(data)
+	return err
+}
+
+// credentialsEmail returns the email of the account whose credentials cfg
+// uses, empty if it cannot be determined.
+func credentialsEmail(ctx context.Context, cfg *config.GCSCli) string {
+	var key struct {
+		ClientEmail string `json:"client_email"`
+	}
+
+	switch cfg.CredentialsSource {
+	case config.ServiceAccountFileCredentialsSource:
+		if json.Unmarshal([]byte(cfg.ServiceAccountFile), &key) == nil {
+			return key.ClientEmail
+		}
+	case config.DefaultCredentialsSource:
+		credentials, err := google.FindDefaultCredentials(ctx, storage.ScopeFullControl)
+		if err != nil {
+			return ""
+		}
+		if len(credentials.JSON) > 0 {
+			if json.Unmarshal(credentials.JSON, &key) == nil {
+				return key.ClientEmail
+			}
+			return ""
+		}
+		// Credentials without JSON are those of the metadata server
+		email, err := metadata.EmailWithContext(ctx, "default")
+		if err == nil {
+			return email
+		}
+	}
+	return ""
+}
+
+// auditPrevious records the generation of the object of handle before op
+// mutates it, if op is audited.
+func (o *operation) auditPrevious(handle *storage.ObjectHandle) {
+	if o.record == nil {
+		return
+	}
+
+	attrs, err := handle.Attrs(o.ctx)
+	if err == nil {
+		o.record.GenerationBefore = attrs.Generation
+	} else if !errors.Is(err, storage.ErrObjectNotExist) {
+		log.Printf("auditing %s: %v\n", o.record.Object, err)
+	}
+}
+
+// auditResult records the object written by op, if op is audited.
+func (o *operation) auditResult(attrs *storage.ObjectAttrs) {
+	if o.record == nil || attrs == nil {
+		return
+	}
+	o.record.GenerationAfter = attrs.Generation
+	o.record.CRC32C = fmt.Sprintf("%08x", attrs.CRC32C)
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// maxBandwidthBurst bounds the bytes transferred at once, so that the
+// throughput of a limited transfer stays smooth.
+const maxBandwidthBurst = 64 << 10
+
+// bandwidthLimiters are shared by every client of the process, keyed by
+// their limit in bytes per second, so that concurrent transfers are
+// limited together.
+var (
+	bandwidthLimitersMu sync.Mutex
+	bandwidthLimiters   = map[int64]*rate.Limiter{}
+)
+
+// bandwidthLimiter returns the limiter of the process for limit bytes per
+// second, nil if limit is zero.
+func bandwidthLimiter(limit int64) *rate.Limiter {
+	if limit <= 0 {
+		return nil
+	}
+
+	bandwidthLimitersMu.Lock()
+	defer bandwidthLimitersMu.Unlock()
+
+	limiter, ok := bandwidthLimiters[limit]
+	if !ok {
+		limiter = rate.NewLimiter(rate.Limit(limit), int(min(limit, maxBandwidthBurst)))
+		bandwidthLimiters[limit] = limiter
+	}
+	return limiter
+}
+
+// limitReader returns reader, limited by limiter if it is not nil.
+func limitReader(reader io.Reader, limiter *rate.Limiter) io.Reader {
+	if limiter == nil {
+		return reader
+	}
+	return &limitedReader{reader: reader, limiter: limiter}
+}
+
+// limitWriter returns writer, limited by limiter if it is not nil.
+func limitWriter(writer io.Writer, limiter *rate.Limiter) io.Writer {
+	if limiter == nil {
+		return writer
+	}
+	return &limitedWriter{writer: writer, limiter: limiter}
+}
+
+type limitedReader struct {
+	reader  io.Reader
+	limiter *rate.Limiter
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > r.limiter.Burst() {
+		p = p[:r.limiter.Burst()]
+	}
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		if waitErr := r.limiter.WaitN(context.Background(), n); waitErr != nil && err == nil {
+			err = waitErr
+		}
+	}
+	return n, err
+}
+
+type limitedWriter struct {
+	writer  io.Writer
+	limiter *rate.Limiter
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p[:min(len(p), w.limiter.Burst())]
+		if err := w.limiter.WaitN(context.Background(), len(chunk)); err != nil {
+			return written, err
+		}
+		n, err := w.writer.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
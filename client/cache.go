@@ -0,0 +1,291 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+
+	"github.com/cloudfoundry/bosh-gcscli/config"
+)
+
+// objectInfo describes the stored bytes of an object, and how to read
+// them.
+type objectInfo struct {
+	Generation      int64             `json:"generation"`
+	CRC32C          uint32            `json:"crc32c"`
+	Size            int64             `json:"size"`
+	ContentEncoding string            `json:"content_encoding,omitempty"`
+	Metadata        map[string]string `json:"metadata,omitempty"`
+}
+
+func newObjectInfo(attrs *storage.ObjectAttrs) objectInfo {
+	return objectInfo{
+		Generation:      attrs.Generation,
+		CRC32C:          attrs.CRC32C,
+		Size:            attrs.Size,
+		ContentEncoding: attrs.ContentEncoding,
+		Metadata:        attrs.Metadata,
+	}
+}
+
+// blobCache keeps the stored bytes of the objects read by get in
+// cache_dir. Each object has a directory, named by the hash of its bucket
+// and name, holding an entry named by its generation and CRC32C, and the
+// objectInfo of the entry in a .json file beside it.
+//
+// Entries are written to a temporary file and renamed into place, so that
+// concurrent processes never read a partial entry. Reading an entry
+// updates its modification time, by which the least recently used entries
+// are evicted.
+type blobCache struct {
+	dir       string
+	maxSize   int64
+	immutable bool
+}
+
+const (
+	cacheInfoSuffix = ".json"
+	cacheTempPrefix = ".tmp-"
+	cacheLockFile   = ".lock"
+	// cacheTempMaxAge is the age beyond which temporary files are left
+	// over by processes which failed
+	cacheTempMaxAge = 24 * time.Hour
+)
+
+// newBlobCache returns the cache of cfg, nil if cache_dir is not set.
+func newBlobCache(cfg *config.GCSCli) *blobCache {
+	if cfg.CacheDir == "" {
+		return nil
+	}
+	return &blobCache{dir: cfg.CacheDir, maxSize: cfg.CacheMaxSizeBytes(), immutable: cfg.CacheImmutable}
+}
+
+// objectDir returns the directory of the entries of the object name.
+func (c *blobCache) objectDir(bucket, name string) string {
+	sum := sha256.Sum256([]byte(bucket + "/" + name))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:]))
+}
+
+func cacheEntryName(info objectInfo) string {
+	return fmt.Sprintf("%d-%08x", info.Generation, info.CRC32C)
+}
+
+// open opens the entry of info in dir, reporting whether it is cached.
+func (c *blobCache) open(dir string, info objectInfo) (*os.File, bool) {
+	path := filepath.Join(dir, cacheEntryName(info))
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, false
+	}
+	touch(path)
+	return file, true
+}
+
+// openLatest opens the entry of the latest generation cached in dir,
+// reporting whether there is one.
+func (c *blobCache) openLatest(dir string) (*os.File, objectInfo, bool) {
+	infoFiles, err := filepath.Glob(filepath.Join(dir, "*"+cacheInfoSuffix))
+	if err != nil {
+		return nil, objectInfo{}, false
+	}
+
+	var latest objectInfo
+	found := false
+	for _, infoFile := range infoFiles {
+		var info objectInfo
+		data, err := os.ReadFile(infoFile)
+		if err != nil || json.Unmarshal(data, &info) != nil {
+			continue
+		}
+		if !found || info.Generation > latest.Generation {
+			latest, found = info, true
+		}
+	}
+	if !found {
+		return nil, objectInfo{}, false
+	}
+
+	file, ok := c.open(dir, latest)
+	return file, latest, ok
+}
+
+// store caches the object of info in dir, reading its stored bytes from
+// src, then replaces the entries of its other generations and evicts the
+// least recently used entries beyond the size of the cache.
+func (c *blobCache) store(dir string, info objectInfo, src io.Reader) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	entry := cacheEntryName(info)
+	written, err := writeCacheFile(dir, filepath.Join(dir, entry), func(w io.Writer) error {
+		_, err := io.Copy(w, src)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if written != info.Size {
+		os.Remove(filepath.Join(dir, entry)) //nolint:errcheck
+		return fmt.Errorf("read %d bytes of %d", written, info.Size)
+	}
+
+	if _, err := writeCacheFile(dir, filepath.Join(dir, entry+cacheInfoSuffix), func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(info)
+	}); err != nil {
+		return err
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		name := file.Name()
+		if name != entry && name != entry+cacheInfoSuffix && !strings.HasPrefix(name, cacheTempPrefix) {
+			removeCacheFile(filepath.Join(dir, name))
+		}
+	}
+
+	c.evict()
+	return nil
+}
+
+// writeCacheFile writes path with write through a temporary file in dir,
+// returning the number of bytes written.
+func writeCacheFile(dir, path string, write func(io.Writer) error) (int64, error) {
+	temp, err := os.CreateTemp(dir, cacheTempPrefix+"*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(temp.Name()) //nolint:errcheck
+
+	counter := &countingWriter{w: temp}
+	if err := write(counter); err != nil {
+		temp.Close() //nolint:errcheck
+		return 0, err
+	}
+	if err := temp.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(temp.Name(), path); err != nil {
+		// On Windows, an entry another process is reading cannot be
+		// replaced, but it holds the same bytes
+		if _, statErr := os.Stat(path); statErr != nil {
+			return 0, err
+		}
+	}
+	return counter.n, nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// evict removes the least recently used entries until the cache fits its
+// size, holding a lock so that processes do not evict concurrently.
+func (c *blobCache) evict() {
+	lock, err := os.OpenFile(filepath.Join(c.dir, cacheLockFile), os.O_WRONLY|os.O_CREATE, 0o600)
+	if err != nil {
+		log.Printf("evicting from cache: %v\n", err)
+		return
+	}
+	defer lock.Close() //nolint:errcheck
+	if err := lockFile(lock); err != nil {
+		log.Printf("evicting from cache: locking: %v\n", err)
+		return
+	}
+	defer unlockFile(lock) //nolint:errcheck
+
+	type entry struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var entries []entry
+	var total int64
+	err = filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		name := d.Name()
+		if name == cacheLockFile || strings.HasSuffix(name, cacheInfoSuffix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if strings.HasPrefix(name, cacheTempPrefix) {
+			if time.Since(info.ModTime()) > cacheTempMaxAge {
+				removeCacheFile(path)
+			}
+			return nil
+		}
+		entries = append(entries, entry{path: path, size: info.Size(), modTime: info.ModTime()})
+		total += info.Size()
+		return nil
+	})
+	if err != nil {
+		log.Printf("evicting from cache: %v\n", err)
+		return
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].modTime.Before(entries[j].modTime) })
+	for _, e := range entries {
+		if total <= c.maxSize {
+			break
+		}
+		removeCacheFile(e.path + cacheInfoSuffix)
+		removeCacheFile(e.path)
+		total -= e.size
+	}
+}
+
+// removeCacheFile removes path, logging failures such as another process
+// reading it on Windows.
+func removeCacheFile(path string) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Printf("removing from cache: %v\n", err)
+	}
+}
+
+// touch marks the entry at path as used now.
+func touch(path string) {
+	now := time.Now()
+	os.Chtimes(path, now, now) //nolint:errcheck
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strconv"
+
+	"cloud.google.com/go/storage"
+)
+
+// The size and CRC32C of the blob uploaded are recorded in the metadata
+// of objects whose stored bytes are compressed or encrypted, so that they
+// can be compared to local files.
+const (
+	sourceSizeMetadataKey   = "bosh-gcscli-source-size"
+	sourceCRC32CMetadataKey = "bosh-gcscli-source-crc32c"
+)
+
+// checksum describes the content of a blob.
+type checksum struct {
+	size   int64
+	crc32c uint32
+	md5    []byte
+}
+
+// readChecksum returns the checksum of the remainder of src, rewinding it
+// to its current position.
+func readChecksum(src io.ReadSeeker) (checksum, error) {
+	pos, err := src.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return checksum{}, fmt.Errorf("finding buffer position: %v", err)
+	}
+
+	crcHash := crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	md5Hash := md5.New()
+	size, err := io.Copy(io.MultiWriter(crcHash, md5Hash), src)
+	if err != nil {
+		return checksum{}, fmt.Errorf("computing checksum: %v", err)
+	}
+
+	if _, err := src.Seek(pos, io.SeekStart); err != nil {
+		return checksum{}, fmt.Errorf("restting buffer position after checksum: %v", err)
+	}
+	return checksum{size: size, crc32c: crcHash.Sum32(), md5: md5Hash.Sum(nil)}, nil
+}
+
+// metadata returns the metadata recording c.
+func (c checksum) metadata() map[string]string {
+	return map[string]string{
+		sourceSizeMetadataKey:   strconv.FormatInt(c.size, 10),
+		sourceCRC32CMetadataKey: fmt.Sprintf("%08x", c.crc32c),
+	}
+}
+
+// matches reports whether the object of attrs holds the content of c,
+// stored as compression and with client-side encryption if encrypted.
+func (c checksum) matches(attrs *storage.ObjectAttrs, compression string, encrypted bool) bool {
+	if attrs.Metadata[compressionMetadataKey] != compression {
+		return false
+	}
+	if _, ok := attrs.Metadata[envelopeSchemeMetadataKey]; ok != encrypted {
+		return false
+	}
+
+	if compression != "" || encrypted {
+		return attrs.Metadata[sourceSizeMetadataKey] == strconv.FormatInt(c.size, 10) &&
+			attrs.Metadata[sourceCRC32CMetadataKey] == fmt.Sprintf("%08x", c.crc32c)
+	}
+
+	if attrs.ContentEncoding != "" || attrs.Size != c.size {
+		return false
+	}
+	// 0 is a valid CRC32C, and the only checksum of composite objects
+	if attrs.CRC32C != 0 || len(attrs.MD5) == 0 {
+		return attrs.CRC32C == c.crc32c
+	}
+	return bytes.Equal(attrs.MD5, c.md5)
+}
+
+// sourceChecksum returns the size and CRC32C of the blob uploaded recorded
+// in metadata, and whether they are.
+func sourceChecksum(metadata map[string]string) (int64, uint32, bool) {
+	size, err := strconv.ParseInt(metadata[sourceSizeMetadataKey], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	crc, err := strconv.ParseUint(metadata[sourceCRC32CMetadataKey], 16, 32)
+	if err != nil {
+		return 0, 0, false
+	}
+	return size, uint32(crc), true
+}
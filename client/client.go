@@ -22,24 +22,65 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/oauth2/google"
+	"golang.org/x/time/rate"
+	"google.golang.org/api/iterator"
 
 	"cloud.google.com/go/storage"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/cloudfoundry/bosh-gcscli/config"
 )
 
-// ErrInvalidROWriteOperation is returned when credentials associated with the
-// client disallow an attempted write operation.
-var ErrInvalidROWriteOperation = errors.New("the client operates in read only mode. Change 'credentials_source' parameter value ")
+// ErrInvalidROWriteOperation is returned when the client is read-only, because
+// it has no credentials or read_only is set, and a write operation is attempted.
+var ErrInvalidROWriteOperation = errors.New("the client operates in read only mode, because 'credentials_source' loads no credentials or 'read_only' or -read-only is set")
+
+// ErrNoReadCredentials is returned by reads when read_strategy is
+// 'authenticated-only' but no credentials could be loaded.
+var ErrNoReadCredentials = errors.New("read_strategy 'authenticated-only' requires credentials, but none could be loaded")
+
+// ErrInvalidBlobID is returned when a blob ID would escape the folder
+// configured for the client.
+var ErrInvalidBlobID = errors.New("blob id must not start with '/' or contain '..' segments")
+
+// ErrClientEncryptionSign is returned by Sign when client_encryption_key
+// is set.
+var ErrClientEncryptionSign = errors.New("signed urls are not supported with client_encryption_key")
+
+// ErrZstdSign is returned by Sign for a GET url of a zstd compressed
+// object, which GCS serves without decompressing it.
+var ErrZstdSign = errors.New("signed GET urls are not supported for zstd compressed objects")
 
 // GCSBlobstore encapsulates interaction with the GCS blobstore
 type GCSBlobstore struct {
 	authenticatedGCS *storage.Client
 	publicGCS        *storage.Client
 	config           *config.GCSCli
+	// limiter limits the bandwidth of transfers, nil if it is unlimited
+	limiter *rate.Limiter
+	// progress receives the progress of transfers, nil if it is not reported
+	progress ProgressFunc
+	// traceParent carries the span of the caller, if any, which the spans
+	// of operations are children of
+	traceParent context.Context
+	// audit records mutating operations, nil if they are not audited
+	audit *auditLog
+	// cache keeps the objects read by get, nil if they are not cached
+	cache *blobCache
+	// secondary is the client of the secondary bucket, nil if there is none
+	secondary *GCSBlobstore
+
+	validateMu sync.Mutex
+	validated  bool
 }
 
 // validateRemoteConfig determines if the configuration of the client matches
@@ -47,23 +88,65 @@ type GCSBlobstore struct {
 //
 // If operating in read-only mode, no mutations can be performed
 // so the remote bucket location is always compatible.
+//
+// A successful validation is remembered for the lifetime of the client,
+// and across invocations for remote_validation_ttl if it is set.
 func (client *GCSBlobstore) validateRemoteConfig() error {
-	if client.readOnly() {
+	if client.ReadOnly() || client.config.RemoteValidation == config.SkipRemoteValidation {
+		return nil
+	}
+
+	client.validateMu.Lock()
+	defer client.validateMu.Unlock()
+	if client.validated {
+		return nil
+	}
+
+	cache := newValidationCache(client.config)
+	if cache.fresh() {
+		client.validated = true
 		return nil
 	}
 
 	bucket := client.authenticatedGCS.Bucket(client.config.BucketName)
-	_, err := bucket.Attrs(context.Background())
+	var err error
+	if client.config.RemoteValidation == config.ObjectProbeRemoteValidation {
+		err = probeObjects(bucket, client.config.Folder)
+	} else {
+		_, err = bucket.Attrs(context.Background())
+	}
+	client.validated = err == nil
+	if client.validated {
+		cache.store()
+	}
 	return err
 }
 
-// getObjectHandle returns a handle to an object named src
-func (client *GCSBlobstore) getObjectHandle(gcs *storage.Client, src string) *storage.ObjectHandle {
-	handle := gcs.Bucket(client.config.BucketName).Object(src)
+// objectName returns the name of the object storing the blob id,
+// which is inside the configured folder if there is one.
+func (client *GCSBlobstore) objectName(id string) (string, error) {
+	if client.config.Folder == "" {
+		return id, nil
+	}
+
+	if strings.HasPrefix(id, "/") || slices.Contains(strings.Split(id, "/"), "..") {
+		return "", ErrInvalidBlobID
+	}
+	return client.config.Folder + "/" + id, nil
+}
+
+// getObjectHandle returns a handle to the object storing the blob src
+func (client *GCSBlobstore) getObjectHandle(gcs *storage.Client, src string) (*storage.ObjectHandle, error) {
+	name, err := client.objectName(src)
+	if err != nil {
+		return nil, err
+	}
+
+	handle := gcs.Bucket(client.config.BucketName).Object(name)
 	if client.config.EncryptionKey != nil {
 		handle = handle.Key(client.config.EncryptionKey)
 	}
-	return handle
+	return handle, nil
 }
 
 // New returns a GCSBlobstore configured to operate using the given config
@@ -80,29 +163,209 @@ func New(ctx context.Context, cfg *config.GCSCli) (*GCSBlobstore, error) {
 		return nil, fmt.Errorf("creating storage client: %v", err)
 	}
 
-	return &GCSBlobstore{authenticatedGCS: authenticatedGCS, publicGCS: publicGCS, config: cfg}, nil
+	blobstore := &GCSBlobstore{
+		authenticatedGCS: authenticatedGCS,
+		publicGCS:        publicGCS,
+		config:           cfg,
+		limiter:          bandwidthLimiter(cfg.MaxBandwidthBytes()),
+		traceParent:      trace.ContextWithSpan(context.Background(), trace.SpanFromContext(ctx)),
+		audit:            newAuditLog(cfg),
+		cache:            newBlobCache(cfg),
+	}
+
+	if secondaryConfig := cfg.SecondaryConfig(); secondaryConfig != nil {
+		if blobstore.secondary, err = New(ctx, secondaryConfig); err != nil {
+			return nil, fmt.Errorf("secondary bucket %s: %v", secondaryConfig.BucketName, err)
+		}
+	}
+	return blobstore, nil
 }
 
 // Get fetches a blob from the GCS blobstore.
 // Destination will be overwritten if it already exists.
 func (client *GCSBlobstore) Get(src string, dest io.Writer) error {
-	reader, err := client.getReader(client.publicGCS, src)
+	_, err := client.GetWithReadPath(src, dest)
+	return err
+}
 
-	// If the public client fails, try using it as an authenticated actor
-	if err != nil && client.authenticatedGCS != nil {
-		reader, err = client.getReader(client.authenticatedGCS, src)
+// GetWithReadPath fetches a blob like Get, also returning the read path,
+// PublicReadPath or AuthenticatedReadPath, which served it.
+func (client *GCSBlobstore) GetWithReadPath(src string, dest io.Writer) (string, error) {
+	return client.GetWithOptions(src, dest, GetOptions{})
+}
+
+// GetOptions are optional settings of reads by GetWithOptions.
+type GetOptions struct {
+	// Raw returns compressed blobs as stored instead of decompressing them.
+	Raw bool `json:"raw,omitempty"`
+}
+
+// GetWithOptions fetches a blob like GetWithReadPath, applying options.
+//
+// If reading the primary bucket fails before any byte was written, the
+// blob is read from the secondary bucket if there is one.
+func (client *GCSBlobstore) GetWithOptions(src string, dest io.Writer, options GetOptions) (string, error) {
+	written := &countingWriter{w: dest}
+	readPath, err := client.getBlob(src, written, options)
+	if written.n > 0 || !client.failover(src, err) {
+		return readPath, err
 	}
+	return secondaryReadPath(client.secondary.getBlob(src, dest, options))
+}
+
+// getBlob fetches a blob from the bucket of the client.
+func (client *GCSBlobstore) getBlob(src string, dest io.Writer, options GetOptions) (_ string, err error) {
+	op := client.startOperation("get", src)
+	defer func() { op.end(err) }()
 
+	paths, err := client.readPaths()
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	_, err = io.Copy(dest, reader)
-	return err
+	op.attempts++
+	for i, path := range paths {
+		op.fallbacks = i
+		var reader io.ReadCloser
+		if reader, err = client.getReader(op.ctx, path.gcs, src, options); err == nil {
+			defer reader.Close() //nolint:errcheck
+			op.bytes, err = io.Copy(dest, reader)
+			return path.name, err
+		}
+		logFallback(paths, i, src, err)
+	}
+	return "", err
 }
 
-func (client *GCSBlobstore) getReader(gcs *storage.Client, src string) (*storage.Reader, error) {
-	return client.getObjectHandle(gcs, src).NewReader(context.Background())
+func (client *GCSBlobstore) getReader(ctx context.Context, gcs *storage.Client, src string, options GetOptions) (io.ReadCloser, error) {
+	handle, err := client.getObjectHandle(gcs, src)
+	if err != nil {
+		return nil, err
+	}
+	// Compressed blobs are decompressed here rather than transcoded by
+	// GCS, so that the checksum of the stored bytes is validated
+	handle = handle.ReadCompressed(true)
+
+	object, info, err := client.openObject(ctx, handle, src)
+	if err != nil {
+		return nil, err
+	}
+
+	var body io.Reader = object
+	encoding := info.ContentEncoding
+	if client.config.ClientEncryptionKey != nil {
+		envelope, err := openEnvelope(client.config.ClientEncryptionKey, src, info.Metadata)
+		if err != nil {
+			object.Close() //nolint:errcheck
+			return nil, fmt.Errorf("reading %s: %w", src, err)
+		}
+		body, encoding = envelope.decrypt(object), info.Metadata[compressionMetadataKey]
+	}
+
+	if options.Raw {
+		encoding = ""
+	}
+	decompressed, err := decompress(encoding, body)
+	if err != nil {
+		object.Close() //nolint:errcheck
+		return nil, fmt.Errorf("reading %s: %v", src, err)
+	}
+	return blobReader{ReadCloser: decompressed, object: object}, nil
+}
+
+// openObject opens the stored bytes of the object of handle, from the
+// cache if there is one.
+func (client *GCSBlobstore) openObject(ctx context.Context, handle *storage.ObjectHandle, src string) (io.ReadCloser, objectInfo, error) {
+	if client.cache == nil {
+		return client.downloadObject(ctx, handle, src)
+	}
+
+	dir := client.cache.objectDir(handle.BucketName(), handle.ObjectName())
+	if client.cache.immutable {
+		if file, info, ok := client.cache.openLatest(dir); ok {
+			return file, info, nil
+		}
+	}
+
+	attrs, err := handle.Attrs(ctx)
+	if err != nil {
+		return nil, objectInfo{}, err
+	}
+	info := newObjectInfo(attrs)
+	if file, ok := client.cache.open(dir, info); ok {
+		return file, info, nil
+	}
+
+	// Pin the generation whose attributes were read
+	reader, err := handle.Generation(info.Generation).NewReader(ctx)
+	if err != nil {
+		return nil, objectInfo{}, err
+	}
+	if info.Size > client.cache.maxSize {
+		return objectReader{Reader: client.downloadReader(reader, src), Closer: reader}, info, nil
+	}
+	defer reader.Close() //nolint:errcheck
+	if err := client.cache.store(dir, info, client.downloadReader(reader, src)); err != nil {
+		return nil, objectInfo{}, fmt.Errorf("caching %s: %v", src, err)
+	}
+
+	file, ok := client.cache.open(dir, info)
+	if !ok {
+		return nil, objectInfo{}, fmt.Errorf("caching %s: evicted before it was read", src)
+	}
+	return file, info, nil
+}
+
+// downloadObject opens the stored bytes of the object of handle.
+func (client *GCSBlobstore) downloadObject(ctx context.Context, handle *storage.ObjectHandle, src string) (io.ReadCloser, objectInfo, error) {
+	if client.config.ClientEncryptionKey == nil {
+		reader, err := handle.NewReader(ctx)
+		if err != nil {
+			return nil, objectInfo{}, err
+		}
+		info := objectInfo{
+			Generation:      reader.Attrs.Generation,
+			CRC32C:          reader.Attrs.CRC32C,
+			Size:            reader.Attrs.Size,
+			ContentEncoding: reader.Attrs.ContentEncoding,
+		}
+		return objectReader{Reader: client.downloadReader(reader, src), Closer: reader}, info, nil
+	}
+
+	attrs, err := handle.Attrs(ctx)
+	if err != nil {
+		return nil, objectInfo{}, err
+	}
+
+	// Pin the generation whose metadata holds the data key
+	reader, err := handle.Generation(attrs.Generation).NewReader(ctx)
+	if err != nil {
+		return nil, objectInfo{}, err
+	}
+	return objectReader{Reader: client.downloadReader(reader, src), Closer: reader}, newObjectInfo(attrs), nil
+}
+
+// objectReader reads the stored bytes of an object.
+type objectReader struct {
+	io.Reader
+	io.Closer
+}
+
+// downloadReader returns the stored bytes of the object src read by reader,
+// limited in bandwidth and reporting their progress.
+func (client *GCSBlobstore) downloadReader(reader *storage.Reader, src string) io.Reader {
+	return client.trackProgress(limitReader(reader, client.limiter), Progress{Op: "get", Blob: src, Total: reader.Attrs.Size})
+}
+
+// blobReader reads a blob, closing the object it is read from when closed.
+type blobReader struct {
+	io.ReadCloser
+	object io.Closer
+}
+
+func (r blobReader) Close() error {
+	r.ReadCloser.Close() //nolint:errcheck
+	return r.object.Close()
 }
 
 // Put uploads a blob to the GCS blobstore.
@@ -112,80 +375,377 @@ func (client *GCSBlobstore) getReader(gcs *storage.Client, src string) (*storage
 const retryAttempts = 3
 
 func (client *GCSBlobstore) Put(src io.ReadSeeker, dest string) error {
-	if client.readOnly() {
-		return ErrInvalidROWriteOperation
+	return client.PutWithOptions(src, dest, PutOptions{})
+}
+
+// PutOptions are optional settings of the objects written by PutWithOptions.
+type PutOptions struct {
+	// CustomTime is set as the custom time of the object if non-zero.
+	CustomTime time.Time `json:"custom_time,omitempty"`
+	// Compression, 'gzip' or 'zstd', is used to compress the blob instead
+	// of the configured compression if non-empty.
+	Compression string `json:"compression,omitempty"`
+	// SkipIfIdentical skips the upload if the object already holds the
+	// blob, as compared by size and checksum, and is stored with the same
+	// compression and client-side encryption.
+	SkipIfIdentical bool `json:"skip_if_identical,omitempty"`
+}
+
+// PutWithOptions uploads a blob like Put, applying options to the object.
+func (client *GCSBlobstore) PutWithOptions(src io.ReadSeeker, dest string, options PutOptions) error {
+	_, err := client.PutWithResult(src, dest, options)
+	return err
+}
+
+// PutWithResult uploads a blob like PutWithOptions, also reporting whether
+// the upload was skipped as the object already holds the blob.
+//
+// The blob is replicated to the secondary bucket if there is one.
+func (client *GCSBlobstore) PutWithResult(src io.ReadSeeker, dest string, options PutOptions) (bool, error) {
+	pos, err := src.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return false, fmt.Errorf("finding buffer position: %v", err)
 	}
 
-	if err := client.validateRemoteConfig(); err != nil {
+	skipped, err := client.putBlob(src, dest, options)
+	if err != nil {
+		return false, err
+	}
+	return skipped, client.replicate(dest, func(secondary *GCSBlobstore) error {
+		if client.config.Replication == config.PrimaryThenAsyncReplication {
+			// src may be closed once the put returned
+			return client.copyToSecondary(dest)
+		}
+		if _, err := src.Seek(pos, io.SeekStart); err != nil {
+			return fmt.Errorf("restting buffer position for replication: %v", err)
+		}
+		_, err := secondary.putBlob(src, dest, options)
 		return err
+	})
+}
+
+// putBlob uploads a blob to the bucket of the client.
+func (client *GCSBlobstore) putBlob(src io.ReadSeeker, dest string, options PutOptions) (_ bool, err error) {
+	op := client.startOperation("put", dest)
+	defer func() { op.end(err) }()
+
+	if client.ReadOnly() {
+		return false, ErrInvalidROWriteOperation
+	}
+
+	handle, err := client.getObjectHandle(client.authenticatedGCS, dest)
+	if err != nil {
+		return false, err
+	}
+
+	if err := client.validateRemoteConfig(); err != nil {
+		return false, err
+	}
+	op.auditPrevious(handle)
+
+	compression := client.compression(options)
+	encrypted := client.config.ClientEncryptionKey != nil
+	var sum *checksum
+	if options.SkipIfIdentical || compression != "" || encrypted {
+		computed, err := readChecksum(src)
+		if err != nil {
+			return false, err
+		}
+		sum = &computed
+	}
+
+	if options.SkipIfIdentical {
+		attrs, err := handle.Attrs(op.ctx)
+		if err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+			return false, err
+		}
+		if err == nil && sum.matches(attrs, compression, encrypted) &&
+			(options.CustomTime.IsZero() || options.CustomTime.Equal(attrs.CustomTime)) {
+			op.span.SetAttributes(attribute.Bool("gcscli.skipped", true))
+			op.auditResult(attrs)
+			return true, nil
+		}
 	}
 
 	pos, err := src.Seek(0, io.SeekCurrent)
 	if err != nil {
-		return fmt.Errorf("finding buffer position: %v", err)
+		return false, fmt.Errorf("finding buffer position: %v", err)
 	}
 
 	var errs []error
 	for i := 0; i < retryAttempts; i++ {
-		err := client.putOnce(src, dest)
+		op.attempts++
+		attrs, written, err := client.putOnce(op.ctx, src, dest, options, sum)
 		if err == nil {
-			return nil
+			op.bytes = written
+			op.auditResult(attrs)
+			return false, nil
 		}
 
 		errs = append(errs, err)
 		log.Printf("upload failed for %s, attempt %d/%d: %v\n", dest, i+1, retryAttempts, err)
 
 		if _, err := src.Seek(pos, io.SeekStart); err != nil {
-			return fmt.Errorf("restting buffer position after failed upload: %v", err)
+			return false, fmt.Errorf("restting buffer position after failed upload: %v", err)
 		}
 	}
 
-	return fmt.Errorf("upload failed for %s after %d attempts: %v", dest, retryAttempts, errs)
+	return false, fmt.Errorf("upload failed for %s after %d attempts: %v", dest, retryAttempts, errs)
+}
+
+// compression returns the encoding with which a blob put with options is
+// compressed, empty if it is not.
+func (client *GCSBlobstore) compression(options PutOptions) string {
+	if options.Compression != "" {
+		return options.Compression
+	}
+	return client.config.Compression
 }
 
-func (client *GCSBlobstore) putOnce(src io.ReadSeeker, dest string) error {
-	remoteWriter := client.getObjectHandle(client.authenticatedGCS, dest).NewWriter(context.Background()) //nolint:staticcheck
-	remoteWriter.ObjectAttrs.StorageClass = client.config.StorageClass                                    //nolint:staticcheck
+// putOnce uploads src to dest, returning the attributes of the object
+// written and the number of bytes read from src. The checksum of src, if
+// not nil, is recorded in the metadata of objects whose stored bytes are
+// transformed.
+func (client *GCSBlobstore) putOnce(ctx context.Context, src io.ReadSeeker, dest string, options PutOptions, sum *checksum) (*storage.ObjectAttrs, int64, error) {
+	handle, err := client.getObjectHandle(client.authenticatedGCS, dest)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	remoteWriter := handle.NewWriter(ctx)                              //nolint:staticcheck
+	remoteWriter.ObjectAttrs.StorageClass = client.config.StorageClass //nolint:staticcheck
+	remoteWriter.ObjectAttrs.CustomTime = options.CustomTime           //nolint:staticcheck
+
+	// Blobs are compressed, then encrypted. Each writer flushes into the
+	// previous one when closed, so they are closed in reverse order.
+	var writers []io.WriteCloser
+	writer := limitWriter(remoteWriter, client.limiter)
+	metadata := map[string]string{}
+
+	var dataKey envelope
+	if client.config.ClientEncryptionKey != nil {
+		var envelopeMetadata map[string]string
+		if dataKey, envelopeMetadata, err = newEnvelope(); err != nil {
+			remoteWriter.CloseWithError(err) //nolint:errcheck,staticcheck
+			return nil, 0, fmt.Errorf("creating data key: %v", err)
+		}
+		maps.Copy(metadata, envelopeMetadata)
+
+		encrypter := dataKey.encrypt(writer)
+		writers = append(writers, encrypter)
+		writer = encrypter
+	}
+
+	compression := client.compression(options)
+	if compression != "" {
+		compressor, err := compress(compression, writer)
+		if err != nil {
+			remoteWriter.CloseWithError(err) //nolint:errcheck,staticcheck
+			return nil, 0, err
+		}
+		metadata[compressionMetadataKey] = compression
+		// Encrypted bytes are not in the encoding, and GCS must not
+		// attempt to decompress them
+		if client.config.ClientEncryptionKey == nil {
+			remoteWriter.ObjectAttrs.ContentEncoding = compression //nolint:staticcheck
+		}
+
+		writers = append(writers, compressor)
+		writer = compressor
+	}
+
+	if len(metadata) > 0 {
+		if sum != nil {
+			maps.Copy(metadata, sum.metadata())
+		}
+		// The data key is wrapped last, as it authenticates the metadata
+		if client.config.ClientEncryptionKey != nil {
+			if err := dataKey.wrap(client.config.ClientEncryptionKey, dest, metadata); err != nil {
+				remoteWriter.CloseWithError(err) //nolint:errcheck,staticcheck
+				return nil, 0, fmt.Errorf("wrapping data key: %v", err)
+			}
+		}
+		remoteWriter.ObjectAttrs.Metadata = metadata //nolint:staticcheck
+	}
 
-	if _, err := io.Copy(remoteWriter, src); err != nil {
+	upload := client.trackProgress(src, Progress{Op: "put", Blob: dest, Total: remainingSize(src)})
+	written, err := io.Copy(writer, upload)
+	if err != nil {
 		remoteWriter.CloseWithError(err) //nolint:errcheck,staticcheck
-		return err
+		return nil, 0, err
+	}
+	for i := len(writers) - 1; i >= 0; i-- {
+		if err := writers[i].Close(); err != nil {
+			remoteWriter.CloseWithError(err) //nolint:errcheck,staticcheck
+			return nil, 0, err
+		}
 	}
 
-	return remoteWriter.Close()
+	if err := remoteWriter.Close(); err != nil {
+		return nil, 0, err
+	}
+	return remoteWriter.Attrs(), written, nil
 }
 
 // Delete removes a blob from from the GCS blobstore.
 //
-// If the object does not exist, Delete returns a nil error.
+// If the object does not exist, Delete returns a nil error. The deletion
+// is replicated to the secondary bucket if there is one.
 func (client *GCSBlobstore) Delete(dest string) error {
-	if client.readOnly() {
+	if err := client.deleteBlob(dest); err != nil {
+		return err
+	}
+	return client.replicate(dest, func(secondary *GCSBlobstore) error {
+		return secondary.deleteBlob(dest)
+	})
+}
+
+// deleteBlob removes a blob from the bucket of the client.
+func (client *GCSBlobstore) deleteBlob(dest string) (err error) {
+	op := client.startOperation("delete", dest)
+	defer func() { op.end(err) }()
+	op.attempts++
+
+	if client.ReadOnly() {
 		return ErrInvalidROWriteOperation
 	}
 
-	err := client.getObjectHandle(client.authenticatedGCS, dest).Delete(context.Background())
+	handle, err := client.getObjectHandle(client.authenticatedGCS, dest)
+	if err != nil {
+		return err
+	}
+	op.auditPrevious(handle)
+
+	err = handle.Delete(op.ctx)
 	if errors.Is(err, storage.ErrObjectNotExist) {
 		return nil
+	} else if err != nil {
+		return explainProtection(handle, dest, err)
+	}
+	return nil
+}
+
+// Copy duplicates a blob within the GCS blobstore.
+// Destination will be overwritten if it already exists.
+//
+// The copy is replicated to the secondary bucket if there is one.
+func (client *GCSBlobstore) Copy(src string, dest string) error {
+	if err := client.copyBlob(src, dest); err != nil {
+		return err
+	}
+	return client.replicate(dest, func(secondary *GCSBlobstore) error {
+		err := secondary.copyBlob(src, dest)
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			// The source was never replicated
+			return client.copyToSecondary(dest)
+		}
+		return err
+	})
+}
+
+// copyBlob duplicates a blob within the bucket of the client.
+func (client *GCSBlobstore) copyBlob(src string, dest string) (err error) {
+	op := client.startOperation("copy", dest)
+	defer func() { op.end(err) }()
+	op.span.SetAttributes(attribute.String("gcscli.source", src))
+	op.attempts++
+	if op.record != nil {
+		op.record.Source = src
+	}
+
+	if client.ReadOnly() {
+		return ErrInvalidROWriteOperation
+	}
+
+	if err := client.validateRemoteConfig(); err != nil {
+		return err
+	}
+
+	srcHandle, err := client.getObjectHandle(client.authenticatedGCS, src)
+	if err != nil {
+		return err
+	}
+	destHandle, err := client.getObjectHandle(client.authenticatedGCS, dest)
+	if err != nil {
+		return err
 	}
+
+	copier := destHandle.CopierFrom(srcHandle)
+	copier.StorageClass = client.config.StorageClass
+
+	// The metadata holds how to read the copy, e.g. its wrapped data key
+	attrs, err := srcHandle.Attrs(op.ctx)
+	if err != nil {
+		return err
+	}
+	copier.Metadata = attrs.Metadata
+	if _, ok := attrs.Metadata[envelopeSchemeMetadataKey]; ok {
+		// The data key is bound to the blob ID, so it is wrapped again
+		if client.config.ClientEncryptionKey == nil {
+			return ErrCopyClientEncrypted
+		}
+		if copier.Metadata, err = rewrapEnvelope(client.config.ClientEncryptionKey, src, dest, attrs.Metadata); err != nil {
+			return fmt.Errorf("copying %s: %w", src, err)
+		}
+	}
+	copier.ContentEncoding = attrs.ContentEncoding
+
+	op.auditPrevious(destHandle)
+	attrs, err = copier.Run(op.ctx)
+	op.auditResult(attrs)
 	return err
 }
 
 // Exists checks if a blob exists in the GCS blobstore.
-func (client *GCSBlobstore) Exists(dest string) (exists bool, err error) {
-	if exists, err = client.exists(client.publicGCS, dest); err == nil {
-		return exists, nil
+func (client *GCSBlobstore) Exists(dest string) (bool, error) {
+	exists, _, err := client.ExistsWithReadPath(dest)
+	return exists, err
+}
+
+// ExistsWithReadPath checks if a blob exists like Exists, also returning
+// the read path, PublicReadPath or AuthenticatedReadPath, which answered.
+//
+// If checking the primary bucket fails, the secondary bucket is checked if
+// there is one.
+func (client *GCSBlobstore) ExistsWithReadPath(dest string) (bool, string, error) {
+	exists, readPath, err := client.existsBlob(dest)
+	if !client.failover(dest, err) {
+		return exists, readPath, err
 	}
+	exists, readPath, err = client.secondary.existsBlob(dest)
+	readPath, err = secondaryReadPath(readPath, err)
+	return exists, readPath, err
+}
+
+// existsBlob checks if a blob exists in the bucket of the client.
+func (client *GCSBlobstore) existsBlob(dest string) (_ bool, _ string, err error) {
+	op := client.startOperation("exists", dest)
+	defer func() { op.end(err) }()
 
-	// If the public client fails, try using it as an authenticated actor
-	if client.authenticatedGCS != nil {
-		return client.exists(client.authenticatedGCS, dest)
+	paths, err := client.readPaths()
+	if err != nil {
+		return false, "", err
 	}
 
-	return
+	op.attempts++
+	for i, path := range paths {
+		op.fallbacks = i
+		var exists bool
+		if exists, err = client.exists(op.ctx, path.gcs, dest); err == nil {
+			return exists, path.name, nil
+		}
+		logFallback(paths, i, dest, err)
+	}
+	return false, "", err
 }
 
-func (client *GCSBlobstore) exists(gcs *storage.Client, dest string) (bool, error) {
-	_, err := client.getObjectHandle(gcs, dest).Attrs(context.Background())
+func (client *GCSBlobstore) exists(ctx context.Context, gcs *storage.Client, dest string) (bool, error) {
+	handle, err := client.getObjectHandle(gcs, dest)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = handle.Attrs(ctx)
 	if err == nil {
 		log.Printf("File '%s' exists in bucket '%s'\n", dest, client.config.BucketName)
 		return true, nil
@@ -196,18 +756,99 @@ func (client *GCSBlobstore) exists(gcs *storage.Client, dest string) (bool, erro
 	return false, err
 }
 
-func (client *GCSBlobstore) readOnly() bool {
-	return client.authenticatedGCS == nil
+// BlobInfo describes a blob in the GCS blobstore.
+type BlobInfo struct {
+	Name   string
+	Size   int64
+	CRC32C uint32
+	MD5    []byte
+	// SourceSize and SourceCRC32C are those of the blob uploaded, recorded
+	// for compressed and client-side encrypted objects as reported by
+	// SourceRecorded, zero otherwise.
+	SourceSize     int64
+	SourceCRC32C   uint32
+	SourceRecorded bool
+}
+
+// List returns the blobs whose names start with prefix.
+//
+// Names are relative to the configured folder if there is one.
+func (client *GCSBlobstore) List(prefix string) ([]BlobInfo, error) {
+	gcs := client.authenticatedGCS
+	if gcs == nil {
+		gcs = client.publicGCS
+	}
+
+	namePrefix, err := client.objectName(prefix)
+	if err != nil {
+		return nil, err
+	}
+	folder := strings.TrimSuffix(namePrefix, prefix)
+
+	query := &storage.Query{Prefix: namePrefix}
+	if err := query.SetAttrSelection([]string{"Name", "Size", "CRC32C", "MD5", "Metadata"}); err != nil {
+		return nil, err
+	}
+
+	var blobs []BlobInfo
+	it := gcs.Bucket(client.config.BucketName).Objects(context.Background(), query)
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			return blobs, nil
+		} else if err != nil {
+			return nil, err
+		}
+		name := strings.TrimPrefix(attrs.Name, folder)
+		blob := BlobInfo{Name: name, Size: attrs.Size, CRC32C: attrs.CRC32C, MD5: attrs.MD5}
+		blob.SourceSize, blob.SourceCRC32C, blob.SourceRecorded = sourceChecksum(attrs.Metadata)
+		blobs = append(blobs, blob)
+	}
+}
+
+// ReadOnly reports whether the client refuses mutating operations,
+// because read_only is set or no credentials could be loaded.
+func (client *GCSBlobstore) ReadOnly() bool {
+	return client.config.ReadOnly || client.authenticatedGCS == nil
 }
 
-func (client *GCSBlobstore) Sign(id string, action string, expiry time.Duration) (string, error) {
+// Sign generates a signed url for the blob id. A read-only client only
+// signs GET urls.
+//
+// Sign fails if client_encryption_key is set, as blobs transferred through
+// the url would bypass client-side encryption, and, if compression is
+// zstd, for a GET url of a zstd compressed object, as GCS only decompresses
+// gzip for clients.
+func (client *GCSBlobstore) Sign(id string, action string, expiry time.Duration) (_ string, err error) {
+	op := client.startOperation("sign", id)
+	defer func() { op.end(err) }()
+	op.attempts++
+
+	expires := time.Now().Add(expiry)
+	if op.record != nil {
+		op.record.SignedURLMethod = action
+		op.record.SignedURLExpiry = &expires
+	}
+
+	if action != http.MethodGet && client.ReadOnly() {
+		return "", ErrInvalidROWriteOperation
+	}
+	if client.config.ClientEncryptionKey != nil {
+		return "", ErrClientEncryptionSign
+	}
+	if action == http.MethodGet && client.config.Compression == config.ZstdCompression {
+		if err := client.checkSignable(op.ctx, id); err != nil {
+			return "", err
+		}
+	}
+
 	token, err := google.JWTConfigFromJSON([]byte(client.config.ServiceAccountFile), storage.ScopeFullControl)
 	if err != nil {
 		return "", err
 	}
 	options := storage.SignedURLOptions{
 		Method:         action,
-		Expires:        time.Now().Add(expiry),
+		Expires:        expires,
 		PrivateKey:     token.PrivateKey,
 		GoogleAccessID: token.Email,
 		Scheme:         storage.SigningSchemeV4,
@@ -223,5 +864,33 @@ func (client *GCSBlobstore) Sign(id string, action string, expiry time.Duration)
 			fmt.Sprintf("x-goog-encryption-key-sha256: %s", client.config.EncryptionKeySha256),
 		}
 	}
-	return storage.SignedURL(client.config.BucketName, id, &options)
+
+	name, err := client.objectName(id)
+	if err != nil {
+		return "", err
+	}
+	return storage.SignedURL(client.config.BucketName, name, &options)
+}
+
+// checkSignable returns ErrZstdSign if the object id is zstd compressed.
+// The check is best-effort: objects which do not exist yet, or whose
+// attributes cannot be read, e.g. without network access, may be signed.
+func (client *GCSBlobstore) checkSignable(ctx context.Context, id string) error {
+	if client.authenticatedGCS == nil {
+		return nil
+	}
+	handle, err := client.getObjectHandle(client.authenticatedGCS, id)
+	if err != nil {
+		return err
+	}
+
+	attrs, err := handle.Attrs(ctx)
+	if err != nil {
+		log.Printf("checking the encoding of %s before signing: %v\n", id, err)
+		return nil
+	}
+	if attrs.ContentEncoding == config.ZstdCompression {
+		return ErrZstdSign
+	}
+	return nil
 }
@@ -0,0 +1,67 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/cloudfoundry/bosh-gcscli/config"
+)
+
+// compressionMetadataKey records the compression of a blob in the object
+// metadata, as the content encoding of client-side encrypted objects
+// cannot reflect it.
+const compressionMetadataKey = "bosh-gcscli-compression"
+
+// compress returns a writer compressing to dest with compression. Close
+// must be called to flush it; it does not close dest.
+func compress(compression string, dest io.Writer) (io.WriteCloser, error) {
+	switch compression {
+	case config.GzipCompression:
+		return gzip.NewWriter(dest), nil
+	case config.ZstdCompression:
+		return zstd.NewWriter(dest)
+	default:
+		return nil, fmt.Errorf("unknown compression: '%s'", compression)
+	}
+}
+
+// decompress returns a reader decompressing src if encoding is a
+// compression written by compress, and src otherwise. Closing it does not
+// close src.
+func decompress(encoding string, src io.Reader) (io.ReadCloser, error) {
+	switch encoding {
+	case config.GzipCompression:
+		reader, err := gzip.NewReader(src)
+		if err != nil {
+			return nil, fmt.Errorf("decompressing: %v", err)
+		}
+		return reader, nil
+	case config.ZstdCompression:
+		reader, err := zstd.NewReader(src)
+		if err != nil {
+			return nil, fmt.Errorf("decompressing: %v", err)
+		}
+		return reader.IOReadCloser(), nil
+	default:
+		return io.NopCloser(src), nil
+	}
+}
@@ -0,0 +1,338 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+
+	"cloud.google.com/go/storage"
+
+	"github.com/cloudfoundry/bosh-gcscli/config"
+)
+
+// Statuses of a Check.
+const (
+	CheckPassed  = "pass"
+	CheckFailed  = "fail"
+	CheckSkipped = "skip"
+)
+
+// Check is the outcome of a single diagnostic performed by Diagnose.
+type Check struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// commandPermissions lists the IAM permissions on the bucket each command
+// needs, in the order they are reported. Commands which validate the
+// bucket beforehand also need the permissions of the remote validation.
+var commandPermissions = []struct {
+	command     string
+	mutating    bool
+	validates   bool
+	permissions []string
+}{
+	{"put", true, true, []string{"storage.objects.create", "storage.objects.delete"}},
+	{"get", false, false, []string{"storage.objects.get"}},
+	{"delete", true, false, []string{"storage.objects.delete"}},
+	{"exists", false, false, []string{"storage.objects.get"}},
+	{"copy", true, true, []string{"storage.objects.get", "storage.objects.create", "storage.objects.delete"}},
+	{"list", false, false, []string{"storage.objects.list"}},
+}
+
+// validationPermissions are the IAM permissions on the bucket the remote
+// validation performed before mutating commands needs.
+var validationPermissions = map[string][]string{
+	"":                                 {"storage.buckets.get"},
+	config.BucketRemoteValidation:      {"storage.buckets.get"},
+	config.ObjectProbeRemoteValidation: {"storage.objects.list"},
+}
+
+// storageClasses are the storage classes accepted by GCS.
+var storageClasses = []string{"STANDARD", "NEARLINE", "COLDLINE", "ARCHIVE", "MULTI_REGIONAL", "REGIONAL", "DURABLE_REDUCED_AVAILABILITY"}
+
+// storageClassLocationTypes are the bucket location types the storage
+// classes restricted to some of them can be used with.
+var storageClassLocationTypes = map[string][]string{
+	"MULTI_REGIONAL": {"multi-region", "dual-region"},
+	"REGIONAL":       {"region"},
+}
+
+// reportFunc records the outcome of the check name.
+type reportFunc func(name, status, format string, args ...interface{})
+
+// Diagnose verifies that cfg allows every command to succeed against its
+// bucket and returns the outcome of each check performed.
+//
+// Checks which cannot be performed because an earlier one failed, or
+// which do not apply to the configuration, are reported as skipped.
+// Unless the client is read-only, a canary object is written and deleted.
+func Diagnose(ctx context.Context, cfg *config.GCSCli) []Check {
+	var checks []Check
+	report := func(name, status, format string, args ...interface{}) {
+		checks = append(checks, Check{Name: name, Status: status, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	if checkCredentials(ctx, cfg, report) {
+		checkToken(ctx, cfg, report)
+	}
+
+	blobstore, err := New(ctx, cfg)
+	if err != nil {
+		report("client", CheckFailed, "%v", err)
+		return checks
+	}
+
+	gcs := blobstore.authenticatedGCS
+	if gcs == nil {
+		gcs = blobstore.publicGCS
+	}
+	bucket := gcs.Bucket(cfg.BucketName)
+
+	attrs, err := bucket.Attrs(ctx)
+	if err != nil && cfg.RemoteValidation != "" && cfg.RemoteValidation != config.BucketRemoteValidation {
+		// storage.buckets.get is not needed without bucket validation
+		attrs = nil
+		report("bucket", CheckSkipped, "reading bucket '%s': %v", cfg.BucketName, err)
+	} else if err != nil {
+		report("bucket", CheckFailed, "reading bucket '%s': %v", cfg.BucketName, err)
+	} else {
+		report("bucket", CheckPassed, "'%s' in %s (%s), default storage class %s", attrs.Name, attrs.Location, attrs.LocationType, attrs.StorageClass)
+	}
+
+	switch {
+	case cfg.StorageClass == "":
+		report("storage_class", CheckSkipped, "not set, the bucket default is used")
+	case !slices.Contains(storageClasses, cfg.StorageClass):
+		report("storage_class", CheckFailed, "unknown storage class %s", cfg.StorageClass)
+	case attrs == nil:
+		report("storage_class", CheckSkipped, "bucket location unknown")
+	case storageClassLocationTypes[cfg.StorageClass] != nil && !slices.Contains(storageClassLocationTypes[cfg.StorageClass], attrs.LocationType):
+		report("storage_class", CheckFailed, "%s cannot be used in a %s bucket", cfg.StorageClass, attrs.LocationType)
+	default:
+		report("storage_class", CheckPassed, "%s can be used in a %s bucket", cfg.StorageClass, attrs.LocationType)
+	}
+
+	checkPermissions(ctx, blobstore, bucket, validationPermissions[cfg.RemoteValidation], report)
+	checkCanary(ctx, blobstore, report)
+
+	return checks
+}
+
+// checkCredentials reports whether the credentials of cfg can be loaded,
+// returning false if there are none to use.
+func checkCredentials(ctx context.Context, cfg *config.GCSCli, report reportFunc) bool {
+	switch cfg.CredentialsSource {
+	case config.NoneCredentialsSource:
+		report("credentials", CheckSkipped, "credentials_source is 'none', the client is read-only")
+		return false
+	case config.ServiceAccountFileCredentialsSource:
+		token, err := google.JWTConfigFromJSON([]byte(cfg.ServiceAccountFile), storage.ScopeFullControl)
+		if err != nil {
+			report("credentials", CheckFailed, "parsing json_key: %v", err)
+			return false
+		}
+		report("credentials", CheckPassed, "service account %s", token.Email)
+		return true
+	case config.DefaultCredentialsSource:
+		credentials, err := google.FindDefaultCredentials(ctx, storage.ScopeFullControl)
+		if err != nil {
+			report("credentials", CheckFailed, "finding application default credentials, the client is read-only: %v", err)
+			return false
+		}
+		var key struct {
+			ClientEmail string `json:"client_email"`
+		}
+		if json.Unmarshal(credentials.JSON, &key) == nil && key.ClientEmail != "" {
+			report("credentials", CheckPassed, "application default credentials of %s", key.ClientEmail)
+		} else {
+			report("credentials", CheckPassed, "application default credentials")
+		}
+		return true
+	default:
+		report("credentials", CheckFailed, "%v", errUnknownCredentialsSource)
+		return false
+	}
+}
+
+// checkToken reports whether an OAuth2 token can be minted for cfg.
+func checkToken(ctx context.Context, cfg *config.GCSCli, report reportFunc) {
+	httpClient, err := newHTTPClient(cfg)
+	if err != nil {
+		report("token", CheckFailed, "%v", err)
+		return
+	}
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, httpClient)
+
+	tokenSource, err := newTokenSource(ctx, cfg)
+	if err != nil {
+		report("token", CheckFailed, "%v", err)
+		return
+	}
+	token, err := tokenSource.Token()
+	if err != nil {
+		report("token", CheckFailed, "minting token: %v", err)
+		return
+	}
+	report("token", CheckPassed, "expires at %s", token.Expiry.Format(time.RFC3339))
+}
+
+// checkPermissions reports, for each command, the permissions it needs
+// which the caller is missing on bucket.
+func checkPermissions(ctx context.Context, blobstore *GCSBlobstore, bucket *storage.BucketHandle, validation []string, report reportFunc) {
+	needs := func(validates bool, permissions []string) []string {
+		if validates {
+			return append(slices.Clone(validation), permissions...)
+		}
+		return permissions
+	}
+
+	var wanted []string
+	for _, command := range commandPermissions {
+		for _, permission := range needs(command.validates, command.permissions) {
+			if !slices.Contains(wanted, permission) {
+				wanted = append(wanted, permission)
+			}
+		}
+	}
+
+	granted, err := bucket.IAM().TestPermissions(ctx, wanted)
+	if err != nil {
+		report("permissions", CheckFailed, "testing permissions: %v", err)
+		return
+	}
+
+	for _, command := range commandPermissions {
+		name := "permissions: " + command.command
+		if command.mutating && blobstore.ReadOnly() {
+			report(name, CheckSkipped, "the client is read-only")
+			continue
+		}
+
+		needed := needs(command.validates, command.permissions)
+		var missing []string
+		for _, permission := range needed {
+			if !slices.Contains(granted, permission) {
+				missing = append(missing, permission)
+			}
+		}
+		if len(missing) > 0 {
+			report(name, CheckFailed, "missing %v", missing)
+		} else {
+			report(name, CheckPassed, "granted %v", needed)
+		}
+	}
+}
+
+// checkCanary reports whether a canary object can be written, read back
+// and deleted, and that it cannot be read without the encryption key.
+func checkCanary(ctx context.Context, blobstore *GCSBlobstore, report reportFunc) {
+	if blobstore.ReadOnly() {
+		report("canary", CheckSkipped, "the client is read-only")
+		return
+	}
+
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		report("canary", CheckFailed, "%v", err)
+		return
+	}
+	id := ".bosh-gcscli-doctor-" + hex.EncodeToString(suffix)
+	content := []byte("bosh-gcscli doctor canary " + id)
+
+	if err := blobstore.Put(bytes.NewReader(content), id); err != nil {
+		report("canary", CheckFailed, "writing %s: %v", id, err)
+		return
+	}
+	defer blobstore.Delete(id) //nolint:errcheck
+
+	var read bytes.Buffer
+	if err := blobstore.Get(id, &read); err != nil {
+		report("canary", CheckFailed, "reading %s: %v", id, err)
+		return
+	} else if !bytes.Equal(read.Bytes(), content) {
+		report("canary", CheckFailed, "content of %s differs from what was written", id)
+		return
+	}
+	report("canary", CheckPassed, "wrote and read back %s", id)
+
+	checkCanaryEncryption(ctx, blobstore, id, report)
+	checkCanaryClientEncryption(ctx, blobstore, id, content, report)
+}
+
+// checkCanaryEncryption reports whether the canary object id is unreadable
+// without the encryption_key.
+func checkCanaryEncryption(ctx context.Context, blobstore *GCSBlobstore, id string, report reportFunc) {
+	if blobstore.config.EncryptionKey == nil {
+		report("canary: encryption", CheckSkipped, "no encryption_key configured")
+		return
+	}
+	name, err := blobstore.objectName(id)
+	if err != nil {
+		report("canary: encryption", CheckFailed, "%v", err)
+		return
+	}
+	reader, err := blobstore.authenticatedGCS.Bucket(blobstore.config.BucketName).Object(name).NewReader(ctx)
+	if err == nil {
+		reader.Close() //nolint:errcheck
+		report("canary: encryption", CheckFailed, "%s can be read without the encryption key", id)
+		return
+	}
+	report("canary: encryption", CheckPassed, "%s cannot be read without the encryption key", id)
+}
+
+// checkCanaryClientEncryption reports whether the canary object id is
+// stored encrypted when client_encryption_key is set.
+func checkCanaryClientEncryption(ctx context.Context, blobstore *GCSBlobstore, id string, content []byte, report reportFunc) {
+	if blobstore.config.ClientEncryptionKey == nil {
+		report("canary: client encryption", CheckSkipped, "no client_encryption_key configured")
+		return
+	}
+	handle, err := blobstore.getObjectHandle(blobstore.authenticatedGCS, id)
+	if err != nil {
+		report("canary: client encryption", CheckFailed, "%v", err)
+		return
+	}
+	reader, err := handle.NewReader(ctx)
+	if err != nil {
+		report("canary: client encryption", CheckFailed, "reading %s: %v", id, err)
+		return
+	}
+	defer reader.Close() //nolint:errcheck
+
+	stored, err := io.ReadAll(reader)
+	if err != nil {
+		report("canary: client encryption", CheckFailed, "reading %s: %v", id, err)
+		return
+	} else if bytes.Contains(stored, content) {
+		report("canary: client encryption", CheckFailed, "%s is stored unencrypted", id)
+		return
+	}
+	report("canary: client encryption", CheckPassed, "%s is stored encrypted", id)
+}
@@ -0,0 +1,309 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"strconv"
+)
+
+// Client-side encrypted objects hold a sequence of chunks, each being up
+// to envelopeChunkSize bytes of the blob sealed with AES-256-GCM under a
+// data key unique to the object. Chunk i uses i as its nonce, and the last
+// chunk is authenticated as such so that truncation is detected.
+//
+// The data key, sealed by the master key, is stored in the object metadata.
+// It is sealed along with the blob ID and the metadata describing how to
+// read the object, so that neither can be changed, nor the key moved to
+// another object, without decryption failing.
+const (
+	envelopeSchemeMetadataKey     = "bosh-gcscli-encryption"
+	envelopeWrappedKeyMetadataKey = "bosh-gcscli-wrapped-key"
+	envelopeChunkSizeMetadataKey  = "bosh-gcscli-chunk-size"
+
+	envelopeScheme    = "AES256-GCM-CHUNKED-1"
+	envelopeChunkSize = 64 << 10
+
+	// maxEnvelopeChunkSize bounds the chunk size read from metadata.
+	maxEnvelopeChunkSize = 16 << 20
+)
+
+// ErrNotClientEncrypted is returned when reading a blob which was not
+// encrypted by the client while client_encryption_key is set.
+var ErrNotClientEncrypted = errors.New("object is not client-side encrypted, but client_encryption_key is set")
+
+// ErrCopyClientEncrypted is returned when copying a client-side encrypted
+// blob while client_encryption_key is not set, as its data key is bound to
+// its blob ID and must be wrapped again for the copy.
+var ErrCopyClientEncrypted = errors.New("copying a client-side encrypted object requires client_encryption_key")
+
+// ErrClientDecryption is returned when a client-side encrypted blob cannot
+// be decrypted, because it was modified, truncated or encrypted with a
+// different client_encryption_key.
+var ErrClientDecryption = errors.New("decrypting object failed, it was modified or encrypted with a different client_encryption_key")
+
+// envelopeBoundMetadataKeys are the metadata authenticated with the
+// wrapped data key.
+var envelopeBoundMetadataKeys = []string{
+	envelopeSchemeMetadataKey,
+	envelopeChunkSizeMetadataKey,
+	compressionMetadataKey,
+	sourceSizeMetadataKey,
+	sourceCRC32CMetadataKey,
+}
+
+// envelope is the data key of a client-side encrypted object.
+type envelope struct {
+	dataKey   []byte
+	aead      cipher.AEAD
+	chunkSize int
+}
+
+// newEnvelope returns a random data key, and the object metadata
+// describing it, which wrap completes.
+func newEnvelope() (envelope, map[string]string, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return envelope{}, nil, err
+	}
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return envelope{}, nil, err
+	}
+	metadata := map[string]string{
+		envelopeSchemeMetadataKey:    envelopeScheme,
+		envelopeChunkSizeMetadataKey: strconv.Itoa(envelopeChunkSize),
+	}
+	return envelope{dataKey: dataKey, aead: aead, chunkSize: envelopeChunkSize}, metadata, nil
+}
+
+// wrap stores the data key in metadata, the complete metadata of the
+// object of blob, wrapped by masterKey.
+func (e envelope) wrap(masterKey []byte, blob string, metadata map[string]string) error {
+	wrapper, err := newGCM(masterKey)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, wrapper.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	wrapped := wrapper.Seal(nonce, nonce, e.dataKey, envelopeData(blob, metadata))
+	metadata[envelopeWrappedKeyMetadataKey] = base64.StdEncoding.EncodeToString(wrapped)
+	return nil
+}
+
+// openEnvelope returns the data key stored in the metadata of the object
+// of blob, unwrapped with masterKey.
+func openEnvelope(masterKey []byte, blob string, metadata map[string]string) (envelope, error) {
+	if metadata[envelopeSchemeMetadataKey] != envelopeScheme {
+		return envelope{}, ErrNotClientEncrypted
+	}
+
+	chunkSize, err := strconv.Atoi(metadata[envelopeChunkSizeMetadataKey])
+	if err != nil || chunkSize < 1 || chunkSize > maxEnvelopeChunkSize {
+		return envelope{}, fmt.Errorf("%w: invalid chunk size", ErrClientDecryption)
+	}
+
+	wrapped, err := base64.StdEncoding.DecodeString(metadata[envelopeWrappedKeyMetadataKey])
+	if err != nil {
+		return envelope{}, fmt.Errorf("%w: invalid wrapped key", ErrClientDecryption)
+	}
+	wrapper, err := newGCM(masterKey)
+	if err != nil {
+		return envelope{}, err
+	}
+	if len(wrapped) < wrapper.NonceSize() {
+		return envelope{}, fmt.Errorf("%w: invalid wrapped key", ErrClientDecryption)
+	}
+	dataKey, err := wrapper.Open(nil, wrapped[:wrapper.NonceSize()], wrapped[wrapper.NonceSize():], envelopeData(blob, metadata))
+	if err != nil {
+		return envelope{}, ErrClientDecryption
+	}
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return envelope{}, err
+	}
+	return envelope{dataKey: dataKey, aead: aead, chunkSize: chunkSize}, nil
+}
+
+// rewrapEnvelope returns the metadata of the object of src, whose data key
+// is wrapped again for the blob dest.
+func rewrapEnvelope(masterKey []byte, src, dest string, metadata map[string]string) (map[string]string, error) {
+	e, err := openEnvelope(masterKey, src, metadata)
+	if err != nil {
+		return nil, err
+	}
+	rewrapped := maps.Clone(metadata)
+	if err := e.wrap(masterKey, dest, rewrapped); err != nil {
+		return nil, err
+	}
+	return rewrapped, nil
+}
+
+// envelopeData returns the additional data authenticated with the wrapped
+// data key of the object of blob: the blob ID and the bound metadata, each
+// length prefixed, and absent metadata distinguished from empty.
+func envelopeData(blob string, metadata map[string]string) []byte {
+	data := binary.AppendUvarint(nil, uint64(len(blob)))
+	data = append(data, blob...)
+	for _, key := range envelopeBoundMetadataKeys {
+		value, ok := metadata[key]
+		if !ok {
+			data = append(data, 0)
+			continue
+		}
+		data = append(data, 1)
+		data = binary.AppendUvarint(data, uint64(len(value)))
+		data = append(data, value...)
+	}
+	return data
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encrypt returns a writer encrypting to dest. Close must be called to
+// write the last chunk; it does not close dest.
+func (e envelope) encrypt(dest io.Writer) io.WriteCloser {
+	return &encryptWriter{envelope: e, dest: dest, plain: make([]byte, 0, e.chunkSize)}
+}
+
+// decrypt returns a reader decrypting src.
+func (e envelope) decrypt(src io.Reader) io.Reader {
+	return &decryptReader{envelope: e, src: bufio.NewReader(src), sealed: make([]byte, e.chunkSize+e.aead.Overhead())}
+}
+
+// nonce returns the nonce of chunk i.
+func (e envelope) nonce(i uint64) []byte {
+	nonce := make([]byte, e.aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], i)
+	return nonce
+}
+
+// chunkData returns the additional data authenticated with a chunk.
+func chunkData(last bool) []byte {
+	if last {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+type encryptWriter struct {
+	envelope
+	dest   io.Writer
+	plain  []byte
+	sealed []byte
+	chunk  uint64
+}
+
+func (w *encryptWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		// A full chunk is only sealed once more data arrives, as the
+		// last chunk must be sealed by Close
+		if len(w.plain) == w.chunkSize {
+			if err := w.seal(false); err != nil {
+				return n, err
+			}
+		}
+		copied := copy(w.plain[len(w.plain):w.chunkSize], p)
+		w.plain = w.plain[:len(w.plain)+copied]
+		p = p[copied:]
+		n += copied
+	}
+	return n, nil
+}
+
+func (w *encryptWriter) Close() error {
+	return w.seal(true)
+}
+
+func (w *encryptWriter) seal(last bool) error {
+	w.sealed = w.aead.Seal(w.sealed[:0], w.nonce(w.chunk), w.plain, chunkData(last))
+	w.chunk++
+	w.plain = w.plain[:0]
+	_, err := w.dest.Write(w.sealed)
+	return err
+}
+
+type decryptReader struct {
+	envelope
+	src    *bufio.Reader
+	sealed []byte
+	plain  []byte
+	chunk  uint64
+	done   bool
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	return n, nil
+}
+
+// open reads and decrypts the next chunk.
+func (r *decryptReader) open() error {
+	n, err := io.ReadFull(r.src, r.sealed)
+	last := errors.Is(err, io.ErrUnexpectedEOF)
+	if errors.Is(err, io.EOF) {
+		return fmt.Errorf("%w: object is truncated", ErrClientDecryption)
+	} else if err == nil {
+		_, err = r.src.Peek(1)
+		last = errors.Is(err, io.EOF)
+		if last {
+			err = nil
+		}
+	}
+	if err != nil && !last {
+		return err
+	}
+
+	plain, err := r.aead.Open(r.sealed[:0], r.nonce(r.chunk), r.sealed[:n], chunkData(last))
+	if err != nil {
+		return ErrClientDecryption
+	}
+	r.chunk++
+	r.plain = plain
+	r.done = last
+	return nil
+}
@@ -0,0 +1,256 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// ErrInvalidLifecycle is returned when a lifecycle configuration would be
+// rejected by GCS.
+var ErrInvalidLifecycle = errors.New("invalid lifecycle configuration")
+
+// lifecycleDate is the layout of the dates of lifecycle conditions.
+const lifecycleDate = "2006-01-02"
+
+// lifecycleConfig is the JSON representation of a bucket lifecycle
+// configuration used by the GCS JSON API, gsutil and gcloud.
+type lifecycleConfig struct {
+	Rule []lifecycleRule `json:"rule"`
+}
+
+type lifecycleRule struct {
+	Action    lifecycleAction    `json:"action"`
+	Condition lifecycleCondition `json:"condition"`
+}
+
+type lifecycleAction struct {
+	Type         string `json:"type"`
+	StorageClass string `json:"storageClass,omitempty"`
+}
+
+type lifecycleCondition struct {
+	Age                     *int64   `json:"age,omitempty"`
+	CreatedBefore           string   `json:"createdBefore,omitempty"`
+	CustomTimeBefore        string   `json:"customTimeBefore,omitempty"`
+	DaysSinceCustomTime     int64    `json:"daysSinceCustomTime,omitempty"`
+	DaysSinceNoncurrentTime int64    `json:"daysSinceNoncurrentTime,omitempty"`
+	IsLive                  *bool    `json:"isLive,omitempty"`
+	MatchesPrefix           []string `json:"matchesPrefix,omitempty"`
+	MatchesStorageClass     []string `json:"matchesStorageClass,omitempty"`
+	MatchesSuffix           []string `json:"matchesSuffix,omitempty"`
+	NoncurrentTimeBefore    string   `json:"noncurrentTimeBefore,omitempty"`
+	NumNewerVersions        int64    `json:"numNewerVersions,omitempty"`
+}
+
+// ParseLifecycle parses and validates a lifecycle configuration in the
+// JSON format of the GCS JSON API, either {"rule": [...]} or
+// {"lifecycle": {"rule": [...]}}.
+func ParseLifecycle(data []byte) (storage.Lifecycle, error) {
+	var wrapper struct {
+		Lifecycle *json.RawMessage `json:"lifecycle"`
+	}
+	if err := json.Unmarshal(data, &wrapper); err != nil {
+		return storage.Lifecycle{}, fmt.Errorf("%w: %v", ErrInvalidLifecycle, err)
+	}
+	if wrapper.Lifecycle != nil {
+		data = *wrapper.Lifecycle
+	}
+
+	var raw lifecycleConfig
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&raw); err != nil {
+		return storage.Lifecycle{}, fmt.Errorf("%w: %v", ErrInvalidLifecycle, err)
+	}
+
+	var lifecycle storage.Lifecycle
+	for i, r := range raw.Rule {
+		rule, err := r.toRule()
+		if err != nil {
+			return storage.Lifecycle{}, fmt.Errorf("%w: rule %d: %v", ErrInvalidLifecycle, i+1, err)
+		}
+		lifecycle.Rules = append(lifecycle.Rules, rule)
+	}
+	return lifecycle, nil
+}
+
+// MarshalLifecycle returns lifecycle in the JSON format read by
+// ParseLifecycle.
+func MarshalLifecycle(lifecycle storage.Lifecycle) ([]byte, error) {
+	raw := lifecycleConfig{Rule: []lifecycleRule{}}
+	for _, rule := range lifecycle.Rules {
+		raw.Rule = append(raw.Rule, newLifecycleRule(rule))
+	}
+	return json.MarshalIndent(raw, "", "  ")
+}
+
+// toRule validates r and converts it to its SDK representation.
+func (r lifecycleRule) toRule() (storage.LifecycleRule, error) {
+	rule := storage.LifecycleRule{Action: storage.LifecycleAction{Type: r.Action.Type, StorageClass: r.Action.StorageClass}}
+
+	switch r.Action.Type {
+	case storage.SetStorageClassAction:
+		if !slices.Contains(storageClasses, r.Action.StorageClass) {
+			return rule, fmt.Errorf("unknown storageClass '%s'", r.Action.StorageClass)
+		}
+	case storage.DeleteAction, storage.AbortIncompleteMPUAction:
+		if r.Action.StorageClass != "" {
+			return rule, fmt.Errorf("storageClass is only allowed for %s", storage.SetStorageClassAction)
+		}
+	default:
+		return rule, fmt.Errorf("unknown action type '%s'", r.Action.Type)
+	}
+
+	c := r.Condition
+	if c.Age == nil && c.CreatedBefore == "" && c.CustomTimeBefore == "" && c.DaysSinceCustomTime == 0 &&
+		c.DaysSinceNoncurrentTime == 0 && c.IsLive == nil && len(c.MatchesPrefix) == 0 &&
+		len(c.MatchesStorageClass) == 0 && len(c.MatchesSuffix) == 0 && c.NoncurrentTimeBefore == "" && c.NumNewerVersions == 0 {
+		return rule, errors.New("at least one condition is required")
+	}
+	if r.Action.Type == storage.AbortIncompleteMPUAction &&
+		(c.CreatedBefore != "" || c.CustomTimeBefore != "" || c.DaysSinceCustomTime != 0 || c.DaysSinceNoncurrentTime != 0 ||
+			c.IsLive != nil || len(c.MatchesStorageClass) != 0 || c.NoncurrentTimeBefore != "" || c.NumNewerVersions != 0) {
+		return rule, fmt.Errorf("%s only supports the age, matchesPrefix and matchesSuffix conditions", storage.AbortIncompleteMPUAction)
+	}
+
+	for _, count := range []struct {
+		name  string
+		value int64
+	}{{"daysSinceCustomTime", c.DaysSinceCustomTime}, {"daysSinceNoncurrentTime", c.DaysSinceNoncurrentTime}, {"numNewerVersions", c.NumNewerVersions}} {
+		if count.value < 0 {
+			return rule, fmt.Errorf("%s must not be negative", count.name)
+		}
+	}
+	if c.Age != nil {
+		if *c.Age < 0 {
+			return rule, errors.New("age must not be negative")
+		}
+		rule.Condition.AllObjects = *c.Age == 0
+		rule.Condition.AgeInDays = *c.Age
+	}
+	rule.Condition.DaysSinceCustomTime = c.DaysSinceCustomTime
+	rule.Condition.DaysSinceNoncurrentTime = c.DaysSinceNoncurrentTime
+	rule.Condition.NumNewerVersions = c.NumNewerVersions
+
+	for _, date := range []struct {
+		name  string
+		value string
+		dest  *time.Time
+	}{
+		{"createdBefore", c.CreatedBefore, &rule.Condition.CreatedBefore},
+		{"customTimeBefore", c.CustomTimeBefore, &rule.Condition.CustomTimeBefore},
+		{"noncurrentTimeBefore", c.NoncurrentTimeBefore, &rule.Condition.NoncurrentTimeBefore},
+	} {
+		if date.value == "" {
+			continue
+		}
+		t, err := time.Parse(lifecycleDate, date.value)
+		if err != nil {
+			return rule, fmt.Errorf("%s must be a date like 2017-06-30", date.name)
+		}
+		*date.dest = t
+	}
+
+	switch {
+	case c.IsLive == nil:
+		rule.Condition.Liveness = storage.LiveAndArchived
+	case *c.IsLive:
+		rule.Condition.Liveness = storage.Live
+	default:
+		rule.Condition.Liveness = storage.Archived
+	}
+
+	for _, class := range c.MatchesStorageClass {
+		if !slices.Contains(storageClasses, class) {
+			return rule, fmt.Errorf("unknown matchesStorageClass '%s'", class)
+		}
+	}
+	rule.Condition.MatchesStorageClasses = c.MatchesStorageClass
+	rule.Condition.MatchesPrefix = c.MatchesPrefix
+	rule.Condition.MatchesSuffix = c.MatchesSuffix
+
+	return rule, nil
+}
+
+// newLifecycleRule returns the JSON representation of rule.
+func newLifecycleRule(rule storage.LifecycleRule) lifecycleRule {
+	r := lifecycleRule{Action: lifecycleAction{Type: rule.Action.Type, StorageClass: rule.Action.StorageClass}}
+	c := rule.Condition
+
+	if c.AllObjects || c.AgeInDays > 0 {
+		age := c.AgeInDays
+		r.Condition.Age = &age
+	}
+	r.Condition.DaysSinceCustomTime = c.DaysSinceCustomTime
+	r.Condition.DaysSinceNoncurrentTime = c.DaysSinceNoncurrentTime
+	r.Condition.NumNewerVersions = c.NumNewerVersions
+
+	if !c.CreatedBefore.IsZero() {
+		r.Condition.CreatedBefore = c.CreatedBefore.Format(lifecycleDate)
+	}
+	if !c.CustomTimeBefore.IsZero() {
+		r.Condition.CustomTimeBefore = c.CustomTimeBefore.Format(lifecycleDate)
+	}
+	if !c.NoncurrentTimeBefore.IsZero() {
+		r.Condition.NoncurrentTimeBefore = c.NoncurrentTimeBefore.Format(lifecycleDate)
+	}
+
+	if c.Liveness != storage.LiveAndArchived {
+		isLive := c.Liveness == storage.Live
+		r.Condition.IsLive = &isLive
+	}
+
+	r.Condition.MatchesPrefix = c.MatchesPrefix
+	r.Condition.MatchesStorageClass = c.MatchesStorageClasses
+	r.Condition.MatchesSuffix = c.MatchesSuffix
+	return r
+}
+
+// Lifecycle returns the lifecycle configuration of the bucket.
+func (client *GCSBlobstore) Lifecycle() (storage.Lifecycle, error) {
+	gcs := client.authenticatedGCS
+	if gcs == nil {
+		gcs = client.publicGCS
+	}
+
+	attrs, err := gcs.Bucket(client.config.BucketName).Attrs(context.Background())
+	if err != nil {
+		return storage.Lifecycle{}, err
+	}
+	return attrs.Lifecycle, nil
+}
+
+// SetLifecycle replaces the lifecycle configuration of the bucket.
+// A lifecycle without rules clears it.
+func (client *GCSBlobstore) SetLifecycle(lifecycle storage.Lifecycle) error {
+	if client.ReadOnly() {
+		return ErrInvalidROWriteOperation
+	}
+
+	update := storage.BucketAttrsToUpdate{Lifecycle: &lifecycle}
+	_, err := client.authenticatedGCS.Bucket(client.config.BucketName).Update(context.Background(), update)
+	return err
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"io"
+)
+
+// Progress is the state of a transfer, reported as it advances.
+type Progress struct {
+	// Op is the operation transferring, 'put' or 'get'.
+	Op string
+	// Blob is the blob ID transferred.
+	Blob string
+	// Transferred is the number of bytes read from the source of a put,
+	// or of the stored object by a get. It restarts at zero if an upload
+	// is retried.
+	Transferred int64
+	// Total is the number of bytes of the transfer, -1 if it is unknown.
+	Total int64
+}
+
+// ProgressFunc receives the progress of transfers. It may be called
+// concurrently by concurrent transfers.
+type ProgressFunc func(Progress)
+
+// SetProgress reports the progress of every following transfer to report,
+// or stops reporting it if report is nil.
+func (client *GCSBlobstore) SetProgress(report ProgressFunc) {
+	client.progress = report
+}
+
+// trackProgress returns reader, reporting the bytes read as the progress
+// of transfer if a ProgressFunc is set.
+func (client *GCSBlobstore) trackProgress(reader io.Reader, transfer Progress) io.Reader {
+	if client.progress == nil {
+		return reader
+	}
+	client.progress(transfer)
+	return &progressReader{reader: reader, progress: transfer, report: client.progress}
+}
+
+// remainingSize returns the number of bytes after the current position of
+// src, -1 if it cannot be determined.
+func remainingSize(src io.Seeker) int64 {
+	pos, err := src.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return -1
+	}
+	end, err := src.Seek(0, io.SeekEnd)
+	if err != nil {
+		return -1
+	}
+	if _, err := src.Seek(pos, io.SeekStart); err != nil {
+		return -1
+	}
+	return end - pos
+}
+
+type progressReader struct {
+	reader   io.Reader
+	progress Progress
+	report   ProgressFunc
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.progress.Transferred += int64(n)
+		r.report(r.progress)
+	}
+	return n, err
+}
@@ -0,0 +1,311 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"cloud.google.com/go/iam"
+	"cloud.google.com/go/storage"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+
+	"github.com/cloudfoundry/bosh-gcscli/config"
+)
+
+// ErrBucketExists is returned by CreateBucket when the bucket exists.
+var ErrBucketExists = errors.New("bucket already exists")
+
+// ErrBucketLocation is returned by EnsureBucket when the bucket exists in
+// another location, which cannot be changed.
+var ErrBucketLocation = errors.New("bucket exists in another location")
+
+// ErrNoProject is returned when a bucket must be created but no project
+// was given or found in the credentials or environment.
+var ErrNoProject = errors.New("no project to create the bucket in")
+
+// ProjectEnv is the environment variable naming the project buckets are
+// created in when neither given nor found in the credentials.
+const ProjectEnv = "GOOGLE_CLOUD_PROJECT"
+
+// DefaultBucketLocation is the location of buckets created without one.
+const DefaultBucketLocation = "US"
+
+// publicReadRole is granted to allUsers on public-read buckets.
+const publicReadRole iam.RoleName = "roles/storage.objectViewer"
+
+// Outcomes of the bucket operations.
+const (
+	BucketCreated   = "created"
+	BucketUpdated   = "updated"
+	BucketUnchanged = "unchanged"
+	BucketDeleted   = "deleted"
+	BucketAbsent    = "absent"
+)
+
+// BucketSettings are the settings of a bucket created by CreateBucket or
+// EnsureBucket. Nil and empty settings are the defaults of GCS when
+// creating a bucket, and left as they are when ensuring an existing one.
+type BucketSettings struct {
+	// Project is the project the bucket is created in, defaulting to the
+	// project of the credentials, then to $GOOGLE_CLOUD_PROJECT.
+	Project string
+	// Location defaults to DefaultBucketLocation when creating the bucket.
+	Location      string
+	StorageClass  string
+	UniformAccess *bool
+	Versioning    *bool
+	// PublicRead grants allUsers read access to the objects of the bucket.
+	PublicRead *bool
+}
+
+// CreateBucket creates the configured bucket with settings, failing with
+// ErrBucketExists if it exists.
+func (client *GCSBlobstore) CreateBucket(settings BucketSettings) error {
+	if client.ReadOnly() {
+		return ErrInvalidROWriteOperation
+	}
+
+	ctx := context.Background()
+	project, err := client.bucketProject(ctx, settings)
+	if err != nil {
+		return err
+	}
+
+	location := settings.Location
+	if location == "" {
+		location = DefaultBucketLocation
+	}
+	attrs := &storage.BucketAttrs{
+		Location:     location,
+		StorageClass: strings.ToUpper(settings.StorageClass),
+	}
+	if settings.UniformAccess != nil {
+		attrs.UniformBucketLevelAccess.Enabled = *settings.UniformAccess
+	}
+	if settings.Versioning != nil {
+		attrs.VersioningEnabled = *settings.Versioning
+	}
+
+	bucket := client.authenticatedGCS.Bucket(client.config.BucketName)
+	if err := bucket.Create(ctx, project, attrs); err != nil {
+		var apiErr *googleapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusConflict {
+			return fmt.Errorf("%w: %s", ErrBucketExists, client.config.BucketName)
+		}
+		return err
+	}
+
+	if settings.PublicRead != nil && *settings.PublicRead {
+		if _, err := setPublicRead(ctx, bucket, true); err != nil {
+			return fmt.Errorf("granting public read: %v", err)
+		}
+	}
+	return nil
+}
+
+// EnsureBucket creates the configured bucket with settings if it does not
+// exist, or updates the settings of the existing bucket which differ,
+// returning BucketCreated, BucketUpdated or BucketUnchanged.
+func (client *GCSBlobstore) EnsureBucket(settings BucketSettings) (string, error) {
+	if client.ReadOnly() {
+		return "", ErrInvalidROWriteOperation
+	}
+
+	ctx := context.Background()
+	bucket := client.authenticatedGCS.Bucket(client.config.BucketName)
+	attrs, err := bucket.Attrs(ctx)
+	if errors.Is(err, storage.ErrBucketNotExist) {
+		err = client.CreateBucket(settings)
+		if err == nil {
+			return BucketCreated, nil
+		} else if !errors.Is(err, ErrBucketExists) {
+			return "", err
+		}
+		// The bucket was created concurrently, its settings are
+		// reconciled as for an existing bucket
+		attrs, err = bucket.Attrs(ctx)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if settings.Location != "" && !strings.EqualFold(attrs.Location, settings.Location) {
+		return "", fmt.Errorf("%w: %s is in %s, not %s", ErrBucketLocation, client.config.BucketName, attrs.Location, settings.Location)
+	}
+
+	var update storage.BucketAttrsToUpdate
+	changed := false
+	if settings.StorageClass != "" && !strings.EqualFold(attrs.StorageClass, settings.StorageClass) {
+		update.StorageClass = strings.ToUpper(settings.StorageClass)
+		changed = true
+	}
+	if settings.UniformAccess != nil && attrs.UniformBucketLevelAccess.Enabled != *settings.UniformAccess {
+		update.UniformBucketLevelAccess = &storage.UniformBucketLevelAccess{Enabled: *settings.UniformAccess}
+		changed = true
+	}
+	if settings.Versioning != nil && attrs.VersioningEnabled != *settings.Versioning {
+		update.VersioningEnabled = *settings.Versioning
+		changed = true
+	}
+	if changed {
+		if _, err := bucket.Update(ctx, update); err != nil {
+			return "", err
+		}
+	}
+
+	if settings.PublicRead != nil {
+		granted, err := setPublicRead(ctx, bucket, *settings.PublicRead)
+		if err != nil {
+			return "", fmt.Errorf("updating public read: %v", err)
+		}
+		changed = changed || granted
+	}
+
+	if changed {
+		return BucketUpdated, nil
+	}
+	return BucketUnchanged, nil
+}
+
+// DeleteBucket deletes the configured bucket, returning BucketDeleted, or
+// BucketAbsent if it does not exist. If force is true, every object
+// generation in the bucket is deleted first, otherwise deleting a bucket
+// which is not empty fails.
+//
+// Each object generation and the bucket are recorded in the audit log.
+func (client *GCSBlobstore) DeleteBucket(force bool) (_ string, err error) {
+	op := client.startOperation("delete-bucket", "")
+	defer func() { op.end(err) }()
+	op.attempts++
+	if op.record != nil {
+		op.record.Object = ""
+	}
+
+	if client.ReadOnly() {
+		return "", ErrInvalidROWriteOperation
+	}
+
+	bucket := client.authenticatedGCS.Bucket(client.config.BucketName)
+	if force {
+		it := bucket.Objects(op.ctx, &storage.Query{Versions: true})
+		for {
+			attrs, err := it.Next()
+			if errors.Is(err, iterator.Done) {
+				break
+			} else if errors.Is(err, storage.ErrBucketNotExist) {
+				return BucketAbsent, nil
+			} else if err != nil {
+				return "", err
+			}
+
+			if err := client.deleteGeneration(bucket, attrs); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	err = bucket.Delete(op.ctx)
+	if errors.Is(err, storage.ErrBucketNotExist) {
+		return BucketAbsent, nil
+	} else if err != nil {
+		return "", err
+	}
+	return BucketDeleted, nil
+}
+
+// deleteGeneration deletes the object generation of attrs from bucket as
+// an audited delete.
+func (client *GCSBlobstore) deleteGeneration(bucket *storage.BucketHandle, attrs *storage.ObjectAttrs) (err error) {
+	op := client.startOperation("delete", attrs.Name)
+	defer func() { op.end(err) }()
+	op.attempts++
+	if op.record != nil {
+		// attrs.Name already includes the folder
+		op.record.Object = attrs.Name
+		op.record.GenerationBefore = attrs.Generation
+	}
+
+	handle := bucket.Object(attrs.Name).Generation(attrs.Generation)
+	err = handle.Delete(op.ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil
+	} else if err != nil {
+		return explainProtection(handle, attrs.Name, err)
+	}
+	return nil
+}
+
+// setPublicRead grants, or revokes, the read access of allUsers to the
+// objects of bucket, reporting whether its policy changed.
+func setPublicRead(ctx context.Context, bucket *storage.BucketHandle, public bool) (bool, error) {
+	policy, err := bucket.IAM().Policy(ctx)
+	if err != nil {
+		return false, err
+	}
+	if policy.HasRole(iam.AllUsers, publicReadRole) == public {
+		return false, nil
+	}
+
+	if public {
+		policy.Add(iam.AllUsers, publicReadRole)
+	} else {
+		policy.Remove(iam.AllUsers, publicReadRole)
+	}
+	return true, bucket.IAM().SetPolicy(ctx, policy)
+}
+
+// bucketProject returns the project a bucket with settings is created in.
+func (client *GCSBlobstore) bucketProject(ctx context.Context, settings BucketSettings) (string, error) {
+	if settings.Project != "" {
+		return settings.Project, nil
+	}
+	if project := credentialsProject(ctx, client.config); project != "" {
+		return project, nil
+	}
+	if project := os.Getenv(ProjectEnv); project != "" {
+		return project, nil
+	}
+	return "", ErrNoProject
+}
+
+// credentialsProject returns the project of the credentials cfg uses,
+// empty if it cannot be determined.
+func credentialsProject(ctx context.Context, cfg *config.GCSCli) string {
+	switch cfg.CredentialsSource {
+	case config.ServiceAccountFileCredentialsSource:
+		var key struct {
+			ProjectID string `json:"project_id"`
+		}
+		if json.Unmarshal([]byte(cfg.ServiceAccountFile), &key) == nil {
+			return key.ProjectID
+		}
+	case config.DefaultCredentialsSource:
+		credentials, err := google.FindDefaultCredentials(ctx, storage.ScopeFullControl)
+		if err == nil {
+			return credentials.ProjectID
+		}
+	}
+	return ""
+}
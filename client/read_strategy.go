@@ -0,0 +1,67 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"log"
+
+	"cloud.google.com/go/storage"
+
+	"github.com/cloudfoundry/bosh-gcscli/config"
+)
+
+// Read paths, naming the client which served a read.
+const (
+	PublicReadPath        = "public"
+	AuthenticatedReadPath = "authenticated"
+)
+
+// readPath is a client reads can be attempted with.
+type readPath struct {
+	name string
+	gcs  *storage.Client
+}
+
+// readPaths returns the clients reads are attempted with, in order,
+// according to the configured read_strategy.
+func (client *GCSBlobstore) readPaths() ([]readPath, error) {
+	public := readPath{name: PublicReadPath, gcs: client.publicGCS}
+	authenticated := readPath{name: AuthenticatedReadPath, gcs: client.authenticatedGCS}
+
+	switch client.config.ReadStrategy {
+	case config.PublicOnlyReadStrategy:
+		return []readPath{public}, nil
+	case config.AuthenticatedOnlyReadStrategy:
+		if client.authenticatedGCS == nil {
+			return nil, ErrNoReadCredentials
+		}
+		return []readPath{authenticated}, nil
+	default:
+		if client.authenticatedGCS == nil {
+			return []readPath{public}, nil
+		}
+		return []readPath{public, authenticated}, nil
+	}
+}
+
+// logFallback logs that the read of id on paths[i] failed with err, if
+// another path is attempted next.
+func logFallback(paths []readPath, i int, id string, err error) {
+	if i+1 < len(paths) {
+		log.Printf("%s read of '%s' failed, trying %s read (set read_strategy to avoid this): %v\n", paths[i].name, id, paths[i+1].name, err)
+	}
+}
@@ -0,0 +1,223 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"sync"
+
+	"cloud.google.com/go/storage"
+
+	"github.com/cloudfoundry/bosh-gcscli/config"
+)
+
+// SecondaryReadPathPrefix prefixes the read path of reads served by the
+// secondary bucket, e.g. 'secondary-authenticated'.
+const SecondaryReadPathPrefix = "secondary-"
+
+// ErrNoSecondary is returned by VerifyReplication when no secondary bucket
+// is configured.
+var ErrNoSecondary = errors.New("no secondary bucket is configured")
+
+// replicationQueueSize bounds the mutations waiting to be replicated in
+// the background before mutations of the primary bucket block.
+const replicationQueueSize = 1024
+
+// Mutations replicated in the background are applied in order by a single
+// goroutine of the process, so that e.g. a put and the following delete
+// of a blob are not reordered.
+var (
+	replicationQueue   = make(chan func(), replicationQueueSize)
+	replicationPending sync.WaitGroup
+	replicationStart   sync.Once
+)
+
+// WaitReplication waits for the mutations being replicated in the
+// background with 'primary-then-async' replication. It must be called
+// before exiting for them to complete.
+func WaitReplication() {
+	replicationPending.Wait()
+}
+
+// replicate applies mutate, which was applied to blob in the primary
+// bucket, to the secondary bucket if there is one: before returning with
+// 'all' replication, or in the background with 'primary-then-async',
+// where failures are only logged.
+func (client *GCSBlobstore) replicate(blob string, mutate func(secondary *GCSBlobstore) error) error {
+	if client.secondary == nil {
+		return nil
+	}
+
+	if client.config.Replication != config.PrimaryThenAsyncReplication {
+		if err := mutate(client.secondary); err != nil {
+			return fmt.Errorf("replicating %s to bucket %s: %w", blob, client.secondary.config.BucketName, err)
+		}
+		return nil
+	}
+
+	replicationStart.Do(func() {
+		go func() {
+			for mutate := range replicationQueue {
+				mutate()
+				replicationPending.Done()
+			}
+		}()
+	})
+	replicationPending.Add(1)
+	replicationQueue <- func() {
+		if err := mutate(client.secondary); err != nil {
+			log.Printf("replicating %s to bucket %s: %v\n", blob, client.secondary.config.BucketName, err)
+		}
+	}
+	return nil
+}
+
+// failover reports whether reading blob failed with err in a way that the
+// secondary bucket should be read instead, logging that it is.
+func (client *GCSBlobstore) failover(blob string, err error) bool {
+	if client.secondary == nil || err == nil ||
+		errors.Is(err, storage.ErrObjectNotExist) || errors.Is(err, ErrInvalidBlobID) {
+		return false
+	}
+	log.Printf("reading %s from secondary bucket %s after: %v\n", blob, client.secondary.config.BucketName, err)
+	return true
+}
+
+// secondaryReadPath prefixes readPath, read from the secondary bucket,
+// unless reading failed with err.
+func secondaryReadPath(readPath string, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	return SecondaryReadPathPrefix + readPath, nil
+}
+
+// copyToSecondary copies the stored bytes and metadata of the object of
+// blob from the primary to the secondary bucket, unless it already holds
+// them.
+func (client *GCSBlobstore) copyToSecondary(blob string) (err error) {
+	op := client.secondary.startOperation("replicate", blob)
+	defer func() { op.end(err) }()
+	op.attempts++
+
+	srcHandle, err := client.getObjectHandle(client.authenticatedGCS, blob)
+	if err != nil {
+		return err
+	}
+	destHandle, err := client.secondary.getObjectHandle(client.secondary.authenticatedGCS, blob)
+	if err != nil {
+		return err
+	}
+
+	attrs, err := srcHandle.Attrs(op.ctx)
+	if err != nil {
+		return err
+	}
+	if existing, err := destHandle.Attrs(op.ctx); err == nil && existing.Size == attrs.Size && existing.CRC32C == attrs.CRC32C {
+		return nil
+	}
+
+	reader, err := srcHandle.Generation(attrs.Generation).ReadCompressed(true).NewReader(op.ctx)
+	if err != nil {
+		return err
+	}
+	defer reader.Close() //nolint:errcheck
+
+	writer := destHandle.NewWriter(op.ctx)
+	writer.ObjectAttrs.StorageClass = client.secondary.config.StorageClass //nolint:staticcheck
+	writer.ObjectAttrs.CustomTime = attrs.CustomTime                       //nolint:staticcheck
+	writer.ObjectAttrs.ContentEncoding = attrs.ContentEncoding             //nolint:staticcheck
+	writer.ObjectAttrs.Metadata = attrs.Metadata                           //nolint:staticcheck
+	writer.ObjectAttrs.CRC32C = attrs.CRC32C                               //nolint:staticcheck
+	writer.SendCRC32C = true
+
+	if op.bytes, err = io.Copy(limitWriter(writer, client.limiter), reader); err != nil {
+		writer.CloseWithError(err) //nolint:errcheck,staticcheck
+		return err
+	}
+	return writer.Close()
+}
+
+// Divergence is a blob whose replicas in the primary and secondary bucket
+// differ.
+type Divergence struct {
+	Blob string `json:"blob"`
+	// Reason is MissingFromSecondary, MissingFromPrimary or ContentDiffers
+	Reason string `json:"reason"`
+}
+
+// Reasons of a Divergence.
+const (
+	MissingFromSecondary = "missing_secondary"
+	MissingFromPrimary   = "missing_primary"
+	ContentDiffers       = "content_differs"
+)
+
+// VerifyReplication compares the blobs whose names start with prefix in
+// the primary and secondary buckets, returning those which diverge, by
+// name, and the number of blobs compared.
+func (client *GCSBlobstore) VerifyReplication(prefix string) ([]Divergence, int, error) {
+	if client.secondary == nil {
+		return nil, 0, ErrNoSecondary
+	}
+
+	primary, err := client.List(prefix)
+	if err != nil {
+		return nil, 0, fmt.Errorf("listing bucket %s: %v", client.config.BucketName, err)
+	}
+	secondary, err := client.secondary.List(prefix)
+	if err != nil {
+		return nil, 0, fmt.Errorf("listing bucket %s: %v", client.secondary.config.BucketName, err)
+	}
+
+	replicas := make(map[string]BlobInfo, len(secondary))
+	for _, blob := range secondary {
+		replicas[blob.Name] = blob
+	}
+
+	var divergences []Divergence
+	for _, blob := range primary {
+		replica, ok := replicas[blob.Name]
+		delete(replicas, blob.Name)
+		switch {
+		case !ok:
+			divergences = append(divergences, Divergence{Blob: blob.Name, Reason: MissingFromSecondary})
+		case !sameContent(blob, replica):
+			divergences = append(divergences, Divergence{Blob: blob.Name, Reason: ContentDiffers})
+		}
+	}
+	for name := range replicas {
+		divergences = append(divergences, Divergence{Blob: name, Reason: MissingFromPrimary})
+	}
+
+	sort.Slice(divergences, func(i, j int) bool { return divergences[i].Blob < divergences[j].Blob })
+	return divergences, len(primary) + len(replicas), nil
+}
+
+// sameContent reports whether the blobs a and b hold the same content,
+// comparing the checksums of the blobs uploaded if both recorded them,
+// as their stored bytes differ when they were encrypted separately.
+func sameContent(a, b BlobInfo) bool {
+	if a.SourceRecorded && b.SourceRecorded {
+		return a.SourceSize == b.SourceSize && a.SourceCRC32C == b.SourceCRC32C
+	}
+	return a.Size == b.Size && a.CRC32C == b.CRC32C
+}
@@ -0,0 +1,134 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// ErrObjectHeld is returned when a blob cannot be deleted because of a
+// temporary or event-based hold.
+var ErrObjectHeld = errors.New("object is under a hold")
+
+// ErrObjectRetained is returned when a blob cannot be deleted because of
+// its retention or the retention policy of the bucket.
+var ErrObjectRetained = errors.New("object is under retention")
+
+// Retention modes of an object.
+const (
+	UnlockedRetention = "Unlocked"
+	LockedRetention   = "Locked"
+)
+
+// Holds selects holds of a blob.
+type Holds struct {
+	Temporary  bool
+	EventBased bool
+}
+
+// SetHolds places, if held is true, or releases the selected holds on the
+// blob id.
+func (client *GCSBlobstore) SetHolds(id string, holds Holds, held bool) error {
+	if client.ReadOnly() {
+		return ErrInvalidROWriteOperation
+	}
+
+	handle, err := client.getObjectHandle(client.authenticatedGCS, id)
+	if err != nil {
+		return err
+	}
+
+	var update storage.ObjectAttrsToUpdate
+	if holds.Temporary {
+		update.TemporaryHold = held
+	}
+	if holds.EventBased {
+		update.EventBasedHold = held
+	}
+	_, err = handle.Update(context.Background(), update)
+	return err
+}
+
+// SetRetention retains the blob id until retainUntil in mode, either
+// UnlockedRetention or LockedRetention.
+//
+// Shortening an unlocked retention, or unlocking it, requires override.
+// A locked retention can only be extended.
+func (client *GCSBlobstore) SetRetention(id string, mode string, retainUntil time.Time, override bool) error {
+	if client.ReadOnly() {
+		return ErrInvalidROWriteOperation
+	}
+
+	handle, err := client.getObjectHandle(client.authenticatedGCS, id)
+	if err != nil {
+		return err
+	}
+
+	update := storage.ObjectAttrsToUpdate{Retention: &storage.ObjectRetention{Mode: mode, RetainUntil: retainUntil}}
+	_, err = handle.OverrideUnlockedRetention(override).Update(context.Background(), update)
+	return err
+}
+
+// Stat returns the attributes of the object storing the blob id,
+// including its holds and retention.
+func (client *GCSBlobstore) Stat(id string) (*storage.ObjectAttrs, error) {
+	paths, err := client.readPaths()
+	if err != nil {
+		return nil, err
+	}
+
+	var attrs *storage.ObjectAttrs
+	for i, path := range paths {
+		var handle *storage.ObjectHandle
+		if handle, err = client.getObjectHandle(path.gcs, id); err != nil {
+			return nil, err
+		}
+		if attrs, err = handle.Attrs(context.Background()); err == nil {
+			return attrs, nil
+		}
+		logFallback(paths, i, id, err)
+	}
+	return nil, err
+}
+
+// explainProtection returns err, the failure to delete the blob id
+// stored by handle, explained by the hold or retention preventing it if
+// there is one.
+func explainProtection(handle *storage.ObjectHandle, id string, err error) error {
+	attrs, attrsErr := handle.Attrs(context.Background())
+	if attrsErr != nil {
+		return err
+	}
+
+	now := time.Now()
+	switch {
+	case attrs.TemporaryHold:
+		return fmt.Errorf("%w: '%s' has a temporary hold, release it with 'hold release --temporary %s': %v", ErrObjectHeld, id, id, err)
+	case attrs.EventBasedHold:
+		return fmt.Errorf("%w: '%s' has an event-based hold, release it with 'hold release --event-based %s': %v", ErrObjectHeld, id, id, err)
+	case attrs.Retention != nil && attrs.Retention.RetainUntil.After(now):
+		return fmt.Errorf("%w: '%s' has a %s retention until %s: %v", ErrObjectRetained, id, attrs.Retention.Mode, attrs.Retention.RetainUntil.Format(time.RFC3339), err)
+	case attrs.RetentionExpirationTime.After(now):
+		return fmt.Errorf("%w: '%s' is retained by the bucket retention policy until %s: %v", ErrObjectRetained, id, attrs.RetentionExpirationTime.Format(time.RFC3339), err)
+	}
+	return err
+}
@@ -18,8 +18,13 @@ package client
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
+	"fmt"
+	"net/url"
 
+	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 
 	"google.golang.org/api/option"
@@ -33,22 +38,121 @@ import (
 const uaString = "bosh-gcscli"
 
 func newStorageClients(ctx context.Context, cfg *config.GCSCli) (*storage.Client, *storage.Client, error) {
-	publicClient, err := storage.NewClient(ctx, option.WithUserAgent(uaString), option.WithHTTPClient(http.DefaultClient))
+	httpClient, err := newHTTPClient(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Token sources use the HTTP client found in the context when minting tokens
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, httpClient)
+
+	newClient := httpStorageClientFactory(httpClient)
+	if cfg.Transport == config.GRPCTransport {
+		newClient = newGRPCStorageClient
+	}
+
+	publicClient, err := newClient(ctx, nil)
 	var authenticatedClient *storage.Client
 
+	// Without usable credentials the client falls back to read-only operations
+	if tokenSource, err := newTokenSource(ctx, cfg); err == nil && tokenSource != nil {
+		authenticatedClient, err = newClient(ctx, tokenSource) //nolint:ineffassign,staticcheck
+	} else if errors.Is(err, errUnknownCredentialsSource) {
+		return nil, nil, err
+	}
+	return authenticatedClient, publicClient, err
+}
+
+// errUnknownCredentialsSource is returned for an unsupported credentials_source.
+var errUnknownCredentialsSource = errors.New("unknown credentials_source in configuration")
+
+// newTokenSource returns the token source for the credentials of cfg,
+// or nil if the configuration has none.
+func newTokenSource(ctx context.Context, cfg *config.GCSCli) (oauth2.TokenSource, error) {
 	switch cfg.CredentialsSource {
 	case config.NoneCredentialsSource:
-		// no-op
+		return nil, nil
 	case config.DefaultCredentialsSource:
-		if tokenSource, err := google.DefaultTokenSource(ctx, storage.ScopeFullControl); err == nil {
-			authenticatedClient, err = storage.NewClient(ctx, option.WithUserAgent(uaString), option.WithTokenSource(tokenSource)) //nolint:ineffassign,staticcheck
-		}
+		return google.DefaultTokenSource(ctx, storage.ScopeFullControl)
 	case config.ServiceAccountFileCredentialsSource:
-		if token, err := google.JWTConfigFromJSON([]byte(cfg.ServiceAccountFile), storage.ScopeFullControl); err == nil {
-			authenticatedClient, err = storage.NewClient(ctx, option.WithUserAgent(uaString), option.WithTokenSource(token.TokenSource(ctx))) //nolint:ineffassign,staticcheck
+		token, err := google.JWTConfigFromJSON([]byte(cfg.ServiceAccountFile), storage.ScopeFullControl)
+		if err != nil {
+			return nil, err
 		}
+		return token.TokenSource(ctx), nil
 	default:
-		return nil, nil, errors.New("unknown credentials_source in configuration")
+		return nil, errUnknownCredentialsSource
 	}
-	return authenticatedClient, publicClient, err
+}
+
+// storageClientFactory creates a storage client authorized by tokenSource,
+// or an unauthenticated client if tokenSource is nil.
+type storageClientFactory func(ctx context.Context, tokenSource oauth2.TokenSource) (*storage.Client, error)
+
+// httpStorageClientFactory returns a storageClientFactory for JSON API
+// clients sharing the transport of httpClient.
+func httpStorageClientFactory(httpClient *http.Client) storageClientFactory {
+	return func(ctx context.Context, tokenSource oauth2.TokenSource) (*storage.Client, error) {
+		client := httpClient
+		if tokenSource != nil {
+			client = authenticatedHTTPClient(httpClient, tokenSource)
+		}
+		return storage.NewClient(ctx, option.WithUserAgent(uaString), option.WithHTTPClient(client))
+	}
+}
+
+// newGRPCStorageClient is a storageClientFactory for gRPC API clients.
+// DirectPath is used when the environment supports it.
+func newGRPCStorageClient(ctx context.Context, tokenSource oauth2.TokenSource) (*storage.Client, error) {
+	auth := option.WithoutAuthentication()
+	if tokenSource != nil {
+		auth = option.WithTokenSource(tokenSource)
+	}
+	return storage.NewGRPCClient(ctx, option.WithUserAgent(uaString), auth)
+}
+
+// newHTTPClient returns the HTTP client shared by all storage clients and
+// token sources, using the proxy and TLS settings of the configuration.
+func newHTTPClient(cfg *config.GCSCli) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if cfg.HTTPProxy != "" {
+		proxyURL, err := url.Parse(cfg.HTTPProxy)
+		if err != nil {
+			return nil, fmt.Errorf("parsing http_proxy: %v", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if cfg.CACert != "" || cfg.ClientCert != "" {
+		tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+		if cfg.CACert != "" {
+			pool, err := x509.SystemCertPool()
+			if err != nil {
+				pool = x509.NewCertPool()
+			}
+			if !pool.AppendCertsFromPEM([]byte(cfg.CACert)) {
+				return nil, config.ErrInvalidCACert
+			}
+			tlsConfig.RootCAs = pool
+		}
+
+		if cfg.ClientCert != "" {
+			cert, err := tls.X509KeyPair([]byte(cfg.ClientCert), []byte(cfg.ClientKey))
+			if err != nil {
+				return nil, fmt.Errorf("loading client_cert: %v", err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// authenticatedHTTPClient returns an HTTP client authorizing every request
+// with a token from tokenSource while sharing the transport of base.
+func authenticatedHTTPClient(base *http.Client, tokenSource oauth2.TokenSource) *http.Client {
+	return &http.Client{Transport: &oauth2.Transport{Source: tokenSource, Base: base.Transport}}
 }
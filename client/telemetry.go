@@ -0,0 +1,144 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName identifies the spans and metrics of the client.
+const instrumentationName = "github.com/cloudfoundry/bosh-gcscli/client"
+
+// meterInstruments record the metrics of blobstore operations.
+type meterInstruments struct {
+	duration metric.Float64Histogram
+	bytes    metric.Int64Counter
+	retries  metric.Int64Counter
+}
+
+// instruments are created from the global meter provider, which forwards
+// them to the provider installed later, if any.
+var instruments = newMeterInstruments()
+
+func newMeterInstruments() meterInstruments {
+	meter := otel.Meter(instrumentationName)
+
+	var i meterInstruments
+	var errs [3]error
+	i.duration, errs[0] = meter.Float64Histogram("gcscli.operation.duration",
+		metric.WithDescription("Duration of blobstore operations"), metric.WithUnit("s"))
+	i.bytes, errs[1] = meter.Int64Counter("gcscli.transferred",
+		metric.WithDescription("Bytes uploaded and downloaded by blobstore operations"), metric.WithUnit("By"))
+	i.retries, errs[2] = meter.Int64Counter("gcscli.operation.retries",
+		metric.WithDescription("Attempts of blobstore operations beyond the first, excluding retries within the GCS SDK"), metric.WithUnit("{attempt}"))
+	if err := errors.Join(errs[:]...); err != nil {
+		log.Printf("creating metric instruments: %v\n", err)
+	}
+	return i
+}
+
+// operation records the span and metrics of a blobstore operation.
+type operation struct {
+	ctx   context.Context
+	span  trace.Span
+	name  string
+	start time.Time
+
+	// bytes is the number of bytes transferred
+	bytes int64
+	// attempts is the number of attempts made, including retries but
+	// not those made within the GCS SDK
+	attempts int
+	// fallbacks is the number of times a read fell back to another read
+	// path, which are not retries
+	fallbacks int
+
+	// record is the audit record of the operation, nil if it is not
+	// audited
+	record *auditRecord
+	audit  *auditLog
+}
+
+// startOperation starts recording the operation name on the blob object.
+// Its context carries the span, and must be used for the requests of the
+// operation.
+func (client *GCSBlobstore) startOperation(name, object string) *operation {
+	ctx, span := otel.Tracer(instrumentationName).Start(client.traceParent, "gcscli."+name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("gcscli.operation", name),
+			attribute.String("gcscli.bucket", client.config.BucketName),
+			attribute.String("gcscli.object", object),
+		))
+	o := &operation{ctx: ctx, span: span, name: name, start: time.Now()}
+	if client.audit != nil && auditedOperations[name] {
+		o.audit = client.audit
+		o.record = &auditRecord{Operation: name, Bucket: client.config.BucketName, Object: object}
+		if name, err := client.objectName(object); err == nil {
+			o.record.Object = name
+		}
+	}
+	return o
+}
+
+// end records the outcome of the operation, failed if err is not nil.
+func (o *operation) end(err error) {
+	outcome := "ok"
+	if err != nil {
+		outcome = "failed"
+		o.span.RecordError(err)
+		o.span.SetStatus(codes.Error, err.Error())
+	}
+
+	o.span.SetAttributes(
+		attribute.String("gcscli.outcome", outcome),
+		attribute.Int64("gcscli.bytes", o.bytes),
+		attribute.Int("gcscli.attempts", o.attempts),
+		attribute.Int("gcscli.fallbacks", o.fallbacks),
+	)
+	o.span.End()
+
+	attrs := metric.WithAttributes(
+		attribute.String("gcscli.operation", o.name),
+		attribute.String("gcscli.outcome", outcome),
+	)
+	instruments.duration.Record(o.ctx, time.Since(o.start).Seconds(), attrs)
+	if o.bytes > 0 {
+		instruments.bytes.Add(o.ctx, o.bytes, attrs)
+	}
+	if o.attempts > 1 {
+		instruments.retries.Add(o.ctx, int64(o.attempts-1), attrs)
+	}
+
+	if o.record != nil {
+		o.record.Time = time.Now().UTC()
+		o.record.Outcome = outcome
+		if err != nil {
+			o.record.Error = err.Error()
+		}
+		o.audit.append(*o.record)
+	}
+}
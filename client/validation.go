@@ -0,0 +1,121 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"google.golang.org/api/iterator"
+
+	"cloud.google.com/go/storage"
+
+	"github.com/cloudfoundry/bosh-gcscli/config"
+)
+
+// probeObjects checks that the objects of bucket below folder can be
+// listed, which only requires the storage.objects.list permission.
+func probeObjects(bucket *storage.BucketHandle, folder string) error {
+	query := &storage.Query{}
+	if folder != "" {
+		query.Prefix = folder + "/"
+	}
+	if err := query.SetAttrSelection([]string{"Name"}); err != nil {
+		return err
+	}
+
+	it := bucket.Objects(context.Background(), query)
+	it.PageInfo().MaxSize = 1
+	if _, err := it.Next(); err != nil && !errors.Is(err, iterator.Done) {
+		return err
+	}
+	return nil
+}
+
+// validationCache remembers successful remote validations across
+// invocations in a file of the user cache directory.
+//
+// A zero validationCache, used when remote_validation_ttl is not set or
+// there is no cache directory, never holds a validation.
+type validationCache struct {
+	path string
+	ttl  time.Duration
+}
+
+// newValidationCache returns the cache of validations for the bucket,
+// validation and credentials of cfg.
+func newValidationCache(cfg *config.GCSCli) validationCache {
+	ttl := cfg.RemoteValidationCacheTTL()
+	if ttl == 0 {
+		return validationCache{}
+	}
+
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return validationCache{}
+	}
+
+	// Credentials are part of the key so that a validation is only
+	// reused by processes with the same access to the bucket
+	key, err := json.Marshal([]string{cfg.BucketName, cfg.Folder, cfg.RemoteValidation, cfg.CredentialsSource, cfg.ServiceAccountFile})
+	if err != nil {
+		return validationCache{}
+	}
+	sum := sha256.Sum256(key)
+	return validationCache{path: filepath.Join(dir, "bosh-gcscli", "validated-"+hex.EncodeToString(sum[:])), ttl: ttl}
+}
+
+// fresh reports whether a validation was stored less than ttl ago.
+func (cache validationCache) fresh() bool {
+	if cache.path == "" {
+		return false
+	}
+
+	contents, err := os.ReadFile(cache.path)
+	if err != nil {
+		return false
+	}
+	validatedAt, err := time.Parse(time.RFC3339Nano, string(contents))
+	if err != nil {
+		return false
+	}
+	age := time.Since(validatedAt)
+	return age >= 0 && age < cache.ttl
+}
+
+// store records a successful validation. Failing to do so only costs a
+// validation in a later invocation, so errors are logged.
+func (cache validationCache) store() {
+	if cache.path == "" {
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cache.path), 0700); err != nil {
+		log.Printf("caching remote validation: %v\n", err)
+		return
+	}
+	if err := os.WriteFile(cache.path, []byte(time.Now().Format(time.RFC3339Nano)), 0600); err != nil {
+		log.Printf("caching remote validation: %v\n", err)
+	}
+}
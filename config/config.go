@@ -18,10 +18,19 @@ package config
 
 import (
 	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"math"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // GCSCli represents the configuration for the gcscli
@@ -36,6 +45,9 @@ type GCSCli struct {
 	// ServiceAccountFile is the contents of a JSON Service Account File.
 	// Required if credentials_source is 'static', otherwise ignored.
 	ServiceAccountFile string `json:"json_key"`
+	// ServiceAccountFilePath is the path of a JSON Service Account File
+	// whose contents are used as json_key. Mutually exclusive with json_key.
+	ServiceAccountFilePath string `json:"json_key_path"`
 	// StorageClass is the type of storage used for objects added to the bucket
 	// https://cloud.google.com/storage/docs/storage-classes
 	StorageClass string `json:"storage_class"`
@@ -45,6 +57,95 @@ type GCSCli struct {
 	// GCS transparently encrypts data using server-side encryption keys.
 	// https://cloud.google.com/storage/docs/encryption
 	EncryptionKey []byte `json:"encryption_key"`
+	// EncryptionKeyFile is the path of a file containing the base64 encoded
+	// encryption_key. Mutually exclusive with encryption_key.
+	EncryptionKeyFile string `json:"encryption_key_file"`
+	// HTTPProxy is the URL of a proxy used for every request to GCS and
+	// to the OAuth2 token endpoints.
+	// If left empty, the proxy is taken from the environment.
+	HTTPProxy string `json:"http_proxy"`
+	// CACert is a PEM encoded bundle of certificate authorities trusted
+	// in addition to the system pool, e.g. for TLS intercepting proxies.
+	CACert string `json:"ca_cert"`
+	// ClientCert is a PEM encoded certificate presented to servers
+	// requiring mutual TLS. Requires client_key.
+	ClientCert string `json:"client_cert"`
+	// ClientKey is the PEM encoded private key of client_cert.
+	ClientKey string `json:"client_key"`
+	// Transport is the API used to talk to GCS, either 'http' for the
+	// JSON API or 'grpc'. If left empty, 'http' will be used.
+	Transport string `json:"transport"`
+	// Folder is prepended to every blob ID, allowing several directors
+	// to share a bucket. Blob IDs cannot escape it.
+	// If left empty, blob IDs are used verbatim as object names.
+	Folder string `json:"folder"`
+	// RemoteValidation is how the bucket is checked before the first
+	// mutation: 'bucket' reads the bucket metadata, requiring
+	// storage.buckets.get, 'object-probe' lists objects, requiring only
+	// object permissions, and 'skip' performs no check.
+	// If left empty, 'bucket' will be used.
+	RemoteValidation string `json:"remote_validation"`
+	// RemoteValidationTTL is a duration, e.g. '1h', for which a successful
+	// remote validation is remembered across invocations.
+	// If left empty, every invocation validates again.
+	RemoteValidationTTL string `json:"remote_validation_ttl"`
+	// ReadStrategy is which clients get and exists use: 'public-first'
+	// tries without credentials and falls back to them, 'authenticated-only'
+	// always uses credentials and 'public-only' never does.
+	// If left empty, 'public-first' will be used.
+	ReadStrategy string `json:"read_strategy"`
+	// ClientEncryptionKey is a 32 byte master key. If set, every blob is
+	// encrypted before upload with AES-256-GCM under its own data key,
+	// which is stored in the object metadata wrapped by the master key.
+	// Blobs without such metadata cannot be read.
+	ClientEncryptionKey []byte `json:"client_encryption_key"`
+	// ClientEncryptionKeyFile is the path of a file containing the base64
+	// encoded client_encryption_key. Mutually exclusive with it.
+	ClientEncryptionKeyFile string `json:"client_encryption_key_file"`
+	// ReadOnly forbids every mutating operation, and signing urls for
+	// them, even if the credentials would allow them.
+	ReadOnly bool `json:"read_only"`
+	// Compression is the encoding, 'gzip' or 'zstd', with which every blob
+	// is compressed before upload. Compressed blobs are decompressed on get.
+	// If left empty, blobs are uploaded as is unless put --compress is used.
+	Compression string `json:"compression"`
+	// MaxBandwidth limits the bytes per second transferred by the uploads
+	// and downloads of a process, combined, e.g. '10MiB' or '500k'.
+	// If left empty, transfers are not limited.
+	MaxBandwidth string `json:"max_bandwidth"`
+	// TelemetryExporter is where traces and metrics of blobstore operations
+	// are exported: 'otlp' to the endpoint of the OTEL_EXPORTER_OTLP_*
+	// environment variables, or 'file' to telemetry_file.
+	// If left empty, no telemetry is exported.
+	TelemetryExporter string `json:"telemetry_exporter"`
+	// TelemetryFile is the path of the file to which the 'file' telemetry
+	// exporter appends JSON encoded spans and metrics.
+	TelemetryFile string `json:"telemetry_file"`
+	// AuditLog is the path of a file to which every put, delete, copy and
+	// sign appends a JSON record, locking it so that concurrent processes
+	// can share it. If left empty, operations are not audited.
+	AuditLog string `json:"audit_log"`
+	// CacheDir is a directory where get keeps the blobs it downloads, which
+	// the processes of a host share. If left empty, blobs are not cached.
+	// It cannot be combined with encryption_key.
+	CacheDir string `json:"cache_dir"`
+	// CacheMaxSize is the size, e.g. '20GiB', beyond which the least
+	// recently used blobs are evicted from cache_dir. Defaults to 10GiB.
+	CacheMaxSize string `json:"cache_max_size"`
+	// CacheImmutable trusts that blobs are never overwritten, so that cached
+	// blobs are read without checking that they are still current.
+	CacheImmutable bool `json:"cache_immutable"`
+	// SkipIfIdentical makes put skip blobs the bucket already holds, as
+	// with put --skip-if-identical.
+	SkipIfIdentical bool `json:"skip_if_identical"`
+	// Secondary is a bucket to which put, copy and delete are replicated,
+	// and from which get and exists read when the primary bucket fails.
+	// If left empty, blobs are not replicated.
+	Secondary *SecondaryBucket `json:"secondary,omitempty"`
+	// Replication is when put, copy and delete succeed: 'all' once both
+	// buckets are written, or 'primary-then-async' once the primary bucket
+	// is. Defaults to 'all'.
+	Replication string `json:"replication"`
 
 	EncryptionKeyEncoded string
 	EncryptionKeySha256  string
@@ -63,6 +164,54 @@ const NoneCredentialsSource = "none"
 // included in json_key should be used for authentication.
 const ServiceAccountFileCredentialsSource = "static"
 
+// ProfileEnv is the environment variable selecting the profile of a
+// multi-profile config if none is selected explicitly.
+const ProfileEnv = "BOSH_GCSCLI_PROFILE"
+
+// HTTPTransport specifies that the GCS JSON API should be used.
+const HTTPTransport = "http"
+
+// GRPCTransport specifies that the GCS gRPC API should be used,
+// including DirectPath when it is available.
+const GRPCTransport = "grpc"
+
+// SkipRemoteValidation specifies that the bucket is not checked before
+// mutations.
+const SkipRemoteValidation = "skip"
+
+// BucketRemoteValidation specifies that the bucket metadata is read
+// before mutations.
+const BucketRemoteValidation = "bucket"
+
+// ObjectProbeRemoteValidation specifies that objects of the bucket are
+// listed before mutations, which only requires object permissions.
+const ObjectProbeRemoteValidation = "object-probe"
+
+// PublicFirstReadStrategy specifies that reads are attempted without
+// credentials first, then with them.
+const PublicFirstReadStrategy = "public-first"
+
+// AuthenticatedOnlyReadStrategy specifies that reads always use credentials.
+const AuthenticatedOnlyReadStrategy = "authenticated-only"
+
+// PublicOnlyReadStrategy specifies that reads never use credentials.
+const PublicOnlyReadStrategy = "public-only"
+
+// GzipCompression specifies that blobs are compressed with gzip, which
+// GCS can decompress for clients unaware of the encoding.
+const GzipCompression = "gzip"
+
+// ZstdCompression specifies that blobs are compressed with zstd.
+const ZstdCompression = "zstd"
+
+// OTLPTelemetryExporter specifies that telemetry is exported with OTLP
+// over HTTP, configured by the standard OTEL_EXPORTER_OTLP_* variables.
+const OTLPTelemetryExporter = "otlp"
+
+// FileTelemetryExporter specifies that telemetry is appended to
+// telemetry_file.
+const FileTelemetryExporter = "file"
+
 // ErrEmptyBucketName is returned when a bucket_name in the config is empty
 var ErrEmptyBucketName = errors.New("bucket_name must be set")
 
@@ -74,15 +223,128 @@ var ErrEmptyServiceAccountFile = errors.New("json_key must be set")
 // in the config is not exactly 32 bytes.
 var ErrWrongLengthEncryptionKey = errors.New("encryption_key not 32 bytes")
 
+// ErrWrongLengthClientEncryptionKey is returned when a non-nil
+// client_encryption_key in the config is not exactly 32 bytes.
+var ErrWrongLengthClientEncryptionKey = errors.New("client_encryption_key not 32 bytes")
+
+// ErrInvalidHTTPProxy is returned when http_proxy in the config is not
+// an absolute URL.
+var ErrInvalidHTTPProxy = errors.New("http_proxy must be an absolute URL")
+
+// ErrInvalidCACert is returned when ca_cert in the config does not
+// contain any PEM encoded certificate.
+var ErrInvalidCACert = errors.New("ca_cert must contain PEM encoded certificates")
+
+// ErrInvalidClientCert is returned when client_cert and client_key in the
+// config are not a matching PEM encoded key pair.
+var ErrInvalidClientCert = errors.New("client_cert and client_key must be a matching PEM encoded key pair")
+
+// ErrUnknownTransport is returned when transport in the config is neither
+// 'http' nor 'grpc'.
+var ErrUnknownTransport = errors.New("transport must be 'http' or 'grpc'")
+
+// ErrGRPCTransportNetwork is returned when the grpc transport is combined
+// with settings only supported by the http transport.
+var ErrGRPCTransportNetwork = errors.New("http_proxy, ca_cert and client_cert are not supported with the grpc transport")
+
+// ErrInvalidFolder is returned when folder in the config contains empty,
+// '.' or '..' segments.
+var ErrInvalidFolder = errors.New("folder must not contain empty, '.' or '..' segments")
+
+// ErrUnknownRemoteValidation is returned when remote_validation in the
+// config is not one of 'skip', 'bucket' or 'object-probe'.
+var ErrUnknownRemoteValidation = errors.New("remote_validation must be 'skip', 'bucket' or 'object-probe'")
+
+// ErrInvalidRemoteValidationTTL is returned when remote_validation_ttl in
+// the config is not a positive duration.
+var ErrInvalidRemoteValidationTTL = errors.New("remote_validation_ttl must be a positive duration, e.g. '1h'")
+
+// ErrUnknownReadStrategy is returned when read_strategy in the config is
+// not one of 'public-first', 'authenticated-only' or 'public-only'.
+var ErrUnknownReadStrategy = errors.New("read_strategy must be 'public-first', 'authenticated-only' or 'public-only'")
+
+// ErrReadStrategyWithoutCredentials is returned when read_strategy in the
+// config is 'authenticated-only' while credentials_source is 'none'.
+var ErrReadStrategyWithoutCredentials = errors.New("read_strategy 'authenticated-only' requires credentials")
+
+// ErrUnknownCompression is returned when compression in the config is
+// neither 'gzip' nor 'zstd'.
+var ErrUnknownCompression = errors.New("compression must be 'gzip' or 'zstd'")
+
+// ErrInvalidMaxBandwidth is returned when max_bandwidth in the config is
+// not a positive number of bytes.
+var ErrInvalidMaxBandwidth = errors.New("max_bandwidth must be a positive number of bytes per second, e.g. '10MiB'")
+
+// ErrInvalidCacheMaxSize is returned when cache_max_size in the config is
+// not a positive number of bytes.
+var ErrInvalidCacheMaxSize = errors.New("cache_max_size must be a positive number of bytes, e.g. '10GiB'")
+
+// ErrCacheWithEncryptionKey is returned when cache_dir is combined with a
+// Customer-Supplied encryption key, as the cache would hold the decrypted
+// blobs and serve them without the key.
+var ErrCacheWithEncryptionKey = errors.New("cache_dir is not supported with encryption_key")
+
+// ErrUnknownTelemetryExporter is returned when telemetry_exporter in the
+// config is neither 'otlp' nor 'file'.
+var ErrUnknownTelemetryExporter = errors.New("telemetry_exporter must be 'otlp' or 'file'")
+
+// ErrEmptyTelemetryFile is returned when telemetry_file in the config is
+// empty while telemetry_exporter is 'file'.
+var ErrEmptyTelemetryFile = errors.New("telemetry_file must be set for telemetry_exporter 'file'")
+
+// ErrNoProfileSelected is returned when a multi-profile config has no
+// default and no profile was selected.
+var ErrNoProfileSelected = errors.New("config has profiles but none was selected and there is no default")
+
+// ErrUnknownProfile is returned when the selected profile is not part
+// of the config.
+var ErrUnknownProfile = errors.New("unknown profile")
+
 // NewFromReader returns the new gcscli configuration struct from the
 // contents of the reader.
 //
-// reader.Read() is expected to return valid JSON.
+// reader.Read() is expected to return valid JSON, either a single
+// configuration or a multi-profile document whose default profile is used.
 func NewFromReader(reader io.Reader) (GCSCli, error) {
+	return NewFromReaderWithProfile(reader, "")
+}
 
+// NewFromReaderWithProfile returns the new gcscli configuration struct
+// for profile from the contents of the reader.
+//
+// reader.Read() is expected to return valid JSON, either a single
+// configuration or a multi-profile document of the form:
+//
+//	{
+//		"default": "name of the profile used if profile is empty (optional)",
+//		"profiles": {"name": {<single configuration>}, ...}
+//	}
+//
+// If profile is empty, the profile named by $BOSH_GCSCLI_PROFILE, or else the
+// default, is used for a multi-profile document. The variable is ignored for
+// a single configuration, while an explicit profile is an error.
+func NewFromReaderWithProfile(reader io.Reader, profile string) (GCSCli, error) {
 	dec := json.NewDecoder(reader)
+	var raw json.RawMessage
+	if err := dec.Decode(&raw); err != nil {
+		return GCSCli{}, err
+	}
+
+	raw, err := selectProfile(raw, profile)
+	if err != nil {
+		return GCSCli{}, err
+	}
+
+	if raw, err = resolveEnvironment(raw); err != nil {
+		return GCSCli{}, err
+	}
+
 	var c GCSCli
-	if err := dec.Decode(&c); err != nil {
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return GCSCli{}, err
+	}
+
+	if err := c.readSecretFiles(); err != nil {
 		return GCSCli{}, err
 	}
 
@@ -99,13 +361,236 @@ func NewFromReader(reader io.Reader) (GCSCli, error) {
 		return GCSCli{}, ErrWrongLengthEncryptionKey
 	}
 
-	if len(c.EncryptionKey) > 0 {
-		c.EncryptionKeyEncoded = base64.StdEncoding.EncodeToString(c.EncryptionKey)
+	if len(c.ClientEncryptionKey) != 32 && c.ClientEncryptionKey != nil {
+		return GCSCli{}, ErrWrongLengthClientEncryptionKey
+	}
+
+	if c.HTTPProxy != "" {
+		if u, err := url.Parse(c.HTTPProxy); err != nil || u.Scheme == "" || u.Host == "" {
+			return GCSCli{}, ErrInvalidHTTPProxy
+		}
+	}
+
+	if c.CACert != "" {
+		if !x509.NewCertPool().AppendCertsFromPEM([]byte(c.CACert)) {
+			return GCSCli{}, ErrInvalidCACert
+		}
+	}
+
+	if c.ClientCert != "" || c.ClientKey != "" {
+		if _, err := tls.X509KeyPair([]byte(c.ClientCert), []byte(c.ClientKey)); err != nil {
+			return GCSCli{}, ErrInvalidClientCert
+		}
+	}
+
+	switch c.Transport {
+	case "", HTTPTransport:
+	case GRPCTransport:
+		if c.HTTPProxy != "" || c.CACert != "" || c.ClientCert != "" {
+			return GCSCli{}, ErrGRPCTransportNetwork
+		}
+	default:
+		return GCSCli{}, ErrUnknownTransport
+	}
+
+	if c.Folder != "" {
+		c.Folder = strings.Trim(c.Folder, "/")
+		for _, segment := range strings.Split(c.Folder, "/") {
+			if segment == "" || segment == "." || segment == ".." {
+				return GCSCli{}, ErrInvalidFolder
+			}
+		}
+	}
 
-		encryptionKeySha := sha256.New()
-		encryptionKeySha.Write(c.EncryptionKey)
-		c.EncryptionKeySha256 = base64.StdEncoding.EncodeToString(encryptionKeySha.Sum(nil))
+	switch c.RemoteValidation {
+	case "", SkipRemoteValidation, BucketRemoteValidation, ObjectProbeRemoteValidation:
+	default:
+		return GCSCli{}, ErrUnknownRemoteValidation
+	}
+
+	switch c.ReadStrategy {
+	case "", PublicFirstReadStrategy, PublicOnlyReadStrategy:
+	case AuthenticatedOnlyReadStrategy:
+		if c.CredentialsSource == NoneCredentialsSource {
+			return GCSCli{}, ErrReadStrategyWithoutCredentials
+		}
+	default:
+		return GCSCli{}, ErrUnknownReadStrategy
+	}
+
+	switch c.Compression {
+	case "", GzipCompression, ZstdCompression:
+	default:
+		return GCSCli{}, ErrUnknownCompression
+	}
+
+	switch c.TelemetryExporter {
+	case "", OTLPTelemetryExporter:
+	case FileTelemetryExporter:
+		if c.TelemetryFile == "" {
+			return GCSCli{}, ErrEmptyTelemetryFile
+		}
+	default:
+		return GCSCli{}, ErrUnknownTelemetryExporter
+	}
+
+	if c.MaxBandwidth != "" {
+		if _, err := ParseBandwidth(c.MaxBandwidth); err != nil {
+			return GCSCli{}, err
+		}
+	}
+
+	if c.CacheMaxSize != "" {
+		if _, err := ParseSize(c.CacheMaxSize); err != nil {
+			return GCSCli{}, err
+		}
+	}
+
+	if c.RemoteValidationTTL != "" {
+		if ttl, err := time.ParseDuration(c.RemoteValidationTTL); err != nil || ttl <= 0 {
+			return GCSCli{}, ErrInvalidRemoteValidationTTL
+		}
+	}
+
+	if err := c.validateSecondary(); err != nil {
+		return GCSCli{}, err
+	}
+
+	if c.CacheDir != "" && (c.EncryptionKey != nil || c.Secondary != nil && c.Secondary.EncryptionKey != nil) {
+		return GCSCli{}, ErrCacheWithEncryptionKey
+	}
+
+	if len(c.EncryptionKey) > 0 {
+		c.encodeEncryptionKey()
 	}
 
 	return c, nil
 }
+
+// encodeEncryptionKey sets the encodings of EncryptionKey sent in headers.
+func (c *GCSCli) encodeEncryptionKey() {
+	c.EncryptionKeyEncoded = base64.StdEncoding.EncodeToString(c.EncryptionKey)
+
+	encryptionKeySha := sha256.New()
+	encryptionKeySha.Write(c.EncryptionKey)
+	c.EncryptionKeySha256 = base64.StdEncoding.EncodeToString(encryptionKeySha.Sum(nil))
+}
+
+// RemoteValidationCacheTTL returns the duration for which a successful
+// remote validation is remembered across invocations, zero if it is not.
+func (c *GCSCli) RemoteValidationCacheTTL() time.Duration {
+	ttl, err := time.ParseDuration(c.RemoteValidationTTL)
+	if err != nil {
+		return 0
+	}
+	return ttl
+}
+
+// selectProfile returns the configuration of profile, or if it is empty of
+// the profile named by ProfileEnv or the default, from a multi-profile
+// document, or the document itself if it is a single configuration.
+func selectProfile(raw json.RawMessage, profile string) (json.RawMessage, error) {
+	var doc struct {
+		Default  string                     `json:"default"`
+		Profiles map[string]json.RawMessage `json:"profiles"`
+	}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+
+	if doc.Profiles == nil {
+		if profile != "" {
+			return nil, fmt.Errorf("%w: '%s' selected but the config has no profiles", ErrUnknownProfile, profile)
+		}
+		return raw, nil
+	}
+
+	if profile == "" {
+		profile = os.Getenv(ProfileEnv)
+	}
+	if profile == "" {
+		profile = doc.Default
+	}
+	if profile == "" {
+		return nil, ErrNoProfileSelected
+	}
+
+	selected, ok := doc.Profiles[profile]
+	if !ok {
+		return nil, fmt.Errorf("%w: '%s'", ErrUnknownProfile, profile)
+	}
+	return selected, nil
+}
+
+// MaxBandwidthBytes returns the bytes per second to which transfers are
+// limited, zero if they are not.
+func (c *GCSCli) MaxBandwidthBytes() int64 {
+	limit, err := ParseBandwidth(c.MaxBandwidth)
+	if err != nil {
+		return 0
+	}
+	return limit
+}
+
+// DefaultCacheMaxSize is the size of cache_dir if cache_max_size is empty.
+const DefaultCacheMaxSize = 10 << 30
+
+// CacheMaxSizeBytes returns the size beyond which blobs are evicted from
+// cache_dir.
+func (c *GCSCli) CacheMaxSizeBytes() int64 {
+	size, err := ParseSize(c.CacheMaxSize)
+	if err != nil {
+		return DefaultCacheMaxSize
+	}
+	return size
+}
+
+// byteUnits are the suffixes accepted by ParseBandwidth and ParseSize.
+var byteUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"ki", 1 << 10}, {"mi", 1 << 20}, {"gi", 1 << 30}, {"ti", 1 << 40},
+	{"k", 1000}, {"m", 1000 * 1000}, {"g", 1000 * 1000 * 1000}, {"t", 1000 * 1000 * 1000 * 1000},
+}
+
+// ParseBandwidth parses a positive number of bytes per second, optionally
+// suffixed by 'k', 'M', 'G' or 'T' for powers of 1000, or 'Ki', 'Mi', 'Gi'
+// or 'Ti' for powers of 1024, and by 'B' and '/s', e.g. '10MiB/s'.
+func ParseBandwidth(s string) (int64, error) {
+	n, ok := parseBytes(strings.TrimSuffix(strings.ToLower(strings.TrimSpace(s)), "/s"))
+	if !ok {
+		return 0, ErrInvalidMaxBandwidth
+	}
+	return n, nil
+}
+
+// ParseSize parses a positive number of bytes, with the suffixes of
+// ParseBandwidth except '/s', e.g. '10GiB'.
+func ParseSize(s string) (int64, error) {
+	n, ok := parseBytes(strings.ToLower(strings.TrimSpace(s)))
+	if !ok {
+		return 0, ErrInvalidCacheMaxSize
+	}
+	return n, nil
+}
+
+// parseBytes parses a lower case positive number of bytes with an optional
+// unit of byteUnits, reporting whether it is valid.
+func parseBytes(value string) (int64, bool) {
+	value = strings.TrimSuffix(value, "b")
+
+	multiplier := int64(1)
+	for _, unit := range byteUnits {
+		if strings.HasSuffix(value, unit.suffix) {
+			value, multiplier = strings.TrimSuffix(value, unit.suffix), unit.multiplier
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n <= 0 || n > math.MaxInt64/multiplier {
+		return 0, false
+	}
+	return n * multiplier, true
+}
@@ -0,0 +1,150 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// SecondaryBucket is a bucket to which blobs are replicated, and from
+// which they are read when the primary bucket fails. Unset credentials
+// and keys are those of the primary bucket.
+type SecondaryBucket struct {
+	// BucketName is the name of the secondary bucket.
+	BucketName string `json:"bucket_name"`
+	// CredentialsSource, ServiceAccountFile and ServiceAccountFilePath
+	// replace the credentials of the primary bucket if any is set.
+	CredentialsSource      string `json:"credentials_source"`
+	ServiceAccountFile     string `json:"json_key"`
+	ServiceAccountFilePath string `json:"json_key_path"`
+	// EncryptionKey, or the key read from EncryptionKeyFile, replaces the
+	// Customer-Supplied encryption key of the primary bucket.
+	EncryptionKey     []byte `json:"encryption_key"`
+	EncryptionKeyFile string `json:"encryption_key_file"`
+	// StorageClass replaces the storage class of the primary bucket.
+	StorageClass string `json:"storage_class"`
+}
+
+// AllReplication makes put, copy and delete succeed once both buckets
+// are written.
+const AllReplication = "all"
+
+// PrimaryThenAsyncReplication makes put, copy and delete succeed once the
+// primary bucket is written, replicating to the secondary in the
+// background.
+const PrimaryThenAsyncReplication = "primary-then-async"
+
+// ErrEmptySecondaryBucketName is returned when secondary is set in the
+// config without a bucket_name.
+var ErrEmptySecondaryBucketName = errors.New("secondary.bucket_name must be set")
+
+// ErrSecondaryIsPrimary is returned when the secondary bucket of the
+// config is the primary bucket.
+var ErrSecondaryIsPrimary = errors.New("secondary.bucket_name must differ from bucket_name")
+
+// ErrUnknownReplication is returned when replication in the config is
+// neither 'all' nor 'primary-then-async'.
+var ErrUnknownReplication = errors.New("replication must be 'all' or 'primary-then-async'")
+
+// validateSecondary reads the secret files of the secondary bucket, if
+// any, and validates it.
+func (c *GCSCli) validateSecondary() error {
+	switch c.Replication {
+	case "", AllReplication, PrimaryThenAsyncReplication:
+	default:
+		return ErrUnknownReplication
+	}
+
+	s := c.Secondary
+	if s == nil {
+		return nil
+	}
+
+	if s.BucketName == "" {
+		return ErrEmptySecondaryBucketName
+	}
+	if s.BucketName == c.BucketName {
+		return ErrSecondaryIsPrimary
+	}
+
+	if s.ServiceAccountFilePath != "" {
+		if s.ServiceAccountFile != "" {
+			return fmt.Errorf("%w: secondary.json_key and secondary.json_key_path", ErrConflictingSources)
+		}
+
+		contents, err := os.ReadFile(s.ServiceAccountFilePath)
+		if err != nil {
+			return fmt.Errorf("reading secondary.json_key_path: %v", err)
+		}
+		s.ServiceAccountFile = string(contents)
+		s.ServiceAccountFilePath = ""
+	}
+
+	if s.EncryptionKeyFile != "" {
+		if s.EncryptionKey != nil {
+			return fmt.Errorf("%w: secondary.encryption_key and secondary.encryption_key_file", ErrConflictingSources)
+		}
+
+		key, err := readKeyFile("secondary.encryption_key_file", s.EncryptionKeyFile)
+		if err != nil {
+			return err
+		}
+		s.EncryptionKey = key
+		s.EncryptionKeyFile = ""
+	}
+
+	if s.CredentialsSource == ServiceAccountFileCredentialsSource && s.ServiceAccountFile == "" {
+		return ErrEmptyServiceAccountFile
+	}
+	if len(s.EncryptionKey) != 32 && s.EncryptionKey != nil {
+		return ErrWrongLengthEncryptionKey
+	}
+	return nil
+}
+
+// SecondaryConfig returns the configuration of the secondary bucket, that
+// of the primary bucket with the fields set in secondary replaced, or nil
+// if there is no secondary bucket.
+func (c *GCSCli) SecondaryConfig() *GCSCli {
+	s := c.Secondary
+	if s == nil {
+		return nil
+	}
+
+	secondary := *c
+	secondary.Secondary = nil
+	secondary.BucketName = s.BucketName
+	if s.CredentialsSource != "" || s.ServiceAccountFile != "" {
+		secondary.CredentialsSource = s.CredentialsSource
+		secondary.ServiceAccountFile = s.ServiceAccountFile
+		// A key given without a source is the one to use, not ambient
+		// credentials
+		if s.CredentialsSource == "" {
+			secondary.CredentialsSource = ServiceAccountFileCredentialsSource
+		}
+	}
+	if s.EncryptionKey != nil {
+		secondary.EncryptionKey = s.EncryptionKey
+		secondary.encodeEncryptionKey()
+	}
+	if s.StorageClass != "" {
+		secondary.StorageClass = s.StorageClass
+	}
+	return &secondary
+}
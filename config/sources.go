@@ -0,0 +1,281 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// EnvPrefix prefixes the environment variables overriding config fields,
+// e.g. BOSH_GCSCLI_BUCKET_NAME overrides bucket_name.
+const EnvPrefix = "BOSH_GCSCLI_"
+
+// envReferencePrefix marks a field whose whole value is read from the
+// environment variable named by the rest of the value, e.g. 'env:KEY'.
+const envReferencePrefix = "env:"
+
+// envReference matches '${ENV_VAR}' references within a field.
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// ErrMissingEnv is returned when a field references an environment
+// variable which is not set.
+var ErrMissingEnv = errors.New("environment variable not set")
+
+// ErrConflictingSources is returned when a value and the file it should
+// be read from are both set.
+var ErrConflictingSources = errors.New("only one of a value and its file may be set")
+
+// resolveEnvironment replaces '${ENV_VAR}' and 'env:ENV_VAR' references in
+// the string values of a raw configuration, at any depth, then applies the
+// overrides found in EnvPrefix environment variables.
+func resolveEnvironment(raw json.RawMessage) (json.RawMessage, error) {
+	raw, err := resolveValue("", reflect.TypeOf(GCSCli{}), raw)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	if fields == nil {
+		fields = map[string]json.RawMessage{}
+	}
+
+	for _, field := range reflect.VisibleFields(reflect.TypeOf(GCSCli{})) {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+
+		value, ok := os.LookupEnv(EnvPrefix + strings.ToUpper(name))
+		if !ok {
+			continue
+		}
+
+		switch field.Type.Kind() {
+		case reflect.String, reflect.Slice:
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				return nil, err
+			}
+			fields[name] = encoded
+		default:
+			if !json.Valid([]byte(value)) {
+				return nil, fmt.Errorf("%s%s is not valid for %s: %s", EnvPrefix, strings.ToUpper(name), name, value)
+			}
+			fields[name] = json.RawMessage(value)
+		}
+	}
+
+	return json.Marshal(fields)
+}
+
+// resolveValue returns value, the JSON of the field path of type t, with
+// the references in its strings replaced. A string referencing the
+// environment for a field which does not hold a string, e.g. '${READ_ONLY}'
+// for a bool, is replaced by the JSON value it resolves to.
+func resolveValue(path string, t reflect.Type, value json.RawMessage) (json.RawMessage, error) {
+	trimmed := bytes.TrimSpace(value)
+	if len(trimmed) == 0 {
+		return value, nil
+	}
+
+	switch trimmed[0] {
+	case '"':
+		var s string
+		if err := json.Unmarshal(value, &s); err != nil {
+			return nil, err
+		}
+		resolved, err := resolveReferences(path, s)
+		if err != nil {
+			return nil, err
+		}
+		if resolved == s || holdsString(t) {
+			return json.Marshal(resolved)
+		}
+		if !json.Valid([]byte(resolved)) {
+			return nil, fmt.Errorf("%s references a value which is not valid for it: %s", path, resolved)
+		}
+		return json.RawMessage(resolved), nil
+	case '{':
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(value, &object); err != nil {
+			return nil, err
+		}
+		for name, v := range object {
+			var err error
+			if object[name], err = resolveValue(joinPath(path, name), fieldType(t, name), v); err != nil {
+				return nil, err
+			}
+		}
+		return json.Marshal(object)
+	case '[':
+		var array []json.RawMessage
+		if err := json.Unmarshal(value, &array); err != nil {
+			return nil, err
+		}
+		var elem reflect.Type
+		if t != nil && t.Kind() == reflect.Slice {
+			elem = t.Elem()
+		}
+		for i, v := range array {
+			var err error
+			if array[i], err = resolveValue(fmt.Sprintf("%s[%d]", path, i), elem, v); err != nil {
+				return nil, err
+			}
+		}
+		return json.Marshal(array)
+	}
+	return value, nil
+}
+
+// holdsString reports whether a field of type t is given as a JSON string,
+// which is assumed for fields of unknown type.
+func holdsString(t reflect.Type) bool {
+	if t == nil {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Interface:
+		return true
+	case reflect.Slice:
+		// []byte is base64 encoded
+		return t.Elem().Kind() == reflect.Uint8
+	}
+	return false
+}
+
+// fieldType returns the type of the field name of a JSON object decoded
+// into t, nil if it is not known.
+func fieldType(t reflect.Type, name string) reflect.Type {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil {
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Map:
+		return t.Elem()
+	case reflect.Struct:
+		for _, field := range reflect.VisibleFields(t) {
+			if tag, _, _ := strings.Cut(field.Tag.Get("json"), ","); tag == name {
+				return field.Type
+			}
+		}
+	}
+	return nil
+}
+
+// joinPath returns the path of the field name within the field path.
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// resolveReferences returns value with its environment references
+// replaced, naming field in errors.
+func resolveReferences(field, value string) (string, error) {
+	if env, ok := strings.CutPrefix(value, envReferencePrefix); ok {
+		resolved, ok := os.LookupEnv(env)
+		if !ok {
+			return "", fmt.Errorf("%w: %s references %s", ErrMissingEnv, field, env)
+		}
+		return resolved, nil
+	}
+
+	var missing []string
+	resolved := envReference.ReplaceAllStringFunc(value, func(ref string) string {
+		env := envReference.FindStringSubmatch(ref)[1]
+		v, ok := os.LookupEnv(env)
+		if !ok {
+			missing = append(missing, env)
+		}
+		return v
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("%w: %s references %s", ErrMissingEnv, field, strings.Join(missing, ", "))
+	}
+	return resolved, nil
+}
+
+// readSecretFiles reads the values configured as paths of files.
+func (c *GCSCli) readSecretFiles() error {
+	if c.ServiceAccountFilePath != "" {
+		if c.ServiceAccountFile != "" {
+			return fmt.Errorf("%w: json_key and json_key_path", ErrConflictingSources)
+		}
+
+		contents, err := os.ReadFile(c.ServiceAccountFilePath)
+		if err != nil {
+			return fmt.Errorf("reading json_key_path: %v", err)
+		}
+		c.ServiceAccountFile = string(contents)
+	}
+
+	if c.EncryptionKeyFile != "" {
+		if c.EncryptionKey != nil {
+			return fmt.Errorf("%w: encryption_key and encryption_key_file", ErrConflictingSources)
+		}
+
+		key, err := readKeyFile("encryption_key_file", c.EncryptionKeyFile)
+		if err != nil {
+			return err
+		}
+		c.EncryptionKey = key
+	}
+
+	if c.ClientEncryptionKeyFile != "" {
+		if c.ClientEncryptionKey != nil {
+			return fmt.Errorf("%w: client_encryption_key and client_encryption_key_file", ErrConflictingSources)
+		}
+
+		key, err := readKeyFile("client_encryption_key_file", c.ClientEncryptionKeyFile)
+		if err != nil {
+			return err
+		}
+		c.ClientEncryptionKey = key
+	}
+
+	return nil
+}
+
+// readKeyFile returns the base64 decoded contents of the file at path,
+// which is the value of the config field.
+func readKeyFile(field, path string) ([]byte, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %v", field, err)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(contents)))
+	if err != nil {
+		return nil, fmt.Errorf("decoding %s %s: %v", field, path, err)
+	}
+	return key, nil
+}
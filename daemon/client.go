@@ -0,0 +1,182 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package daemon
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"time"
+
+	"github.com/cloudfoundry/bosh-gcscli/client"
+	"github.com/cloudfoundry/bosh-gcscli/config"
+)
+
+// Client forwards operations to a daemon listening on a Unix socket.
+type Client struct {
+	socket      string
+	fingerprint string
+	bucketName  string
+}
+
+// Dial returns a Client for the daemon listening on socket.
+//
+// A non-nil error is returned if no daemon is listening or if it serves
+// a configuration different from cfg.
+func Dial(socket string, cfg *config.GCSCli) (*Client, error) {
+	fingerprint, err := Fingerprint(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{socket: socket, fingerprint: fingerprint, bucketName: cfg.BucketName}
+	if _, err := c.do(request{Op: opHello}, nil, nil); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Put uploads a blob through the daemon.
+func (c *Client) Put(src io.ReadSeeker, dest string) error {
+	_, err := c.do(request{Op: opPut, Object: dest}, src, nil)
+	return err
+}
+
+// PutWithOptions uploads a blob through the daemon, applying options to
+// the object.
+func (c *Client) PutWithOptions(src io.ReadSeeker, dest string, options client.PutOptions) error {
+	_, err := c.do(request{Op: opPut, Object: dest, PutOptions: &options}, src, nil)
+	return err
+}
+
+// PutWithResult uploads a blob through the daemon, applying options to
+// the object and reporting whether the upload was skipped.
+func (c *Client) PutWithResult(src io.ReadSeeker, dest string, options client.PutOptions) (bool, error) {
+	res, err := c.do(request{Op: opPut, Object: dest, PutOptions: &options}, src, nil)
+	return res.Skipped, err
+}
+
+// Get fetches a blob through the daemon.
+func (c *Client) Get(src string, dest io.Writer) error {
+	_, err := c.GetWithReadPath(src, dest)
+	return err
+}
+
+// GetWithReadPath fetches a blob through the daemon, also returning the
+// read path which served it.
+func (c *Client) GetWithReadPath(src string, dest io.Writer) (string, error) {
+	res, err := c.do(request{Op: opGet, Object: src}, nil, dest)
+	return res.ReadPath, err
+}
+
+// GetWithOptions fetches a blob through the daemon, applying options.
+func (c *Client) GetWithOptions(src string, dest io.Writer, options client.GetOptions) (string, error) {
+	res, err := c.do(request{Op: opGet, Object: src, GetOptions: &options}, nil, dest)
+	return res.ReadPath, err
+}
+
+// Delete removes a blob through the daemon.
+func (c *Client) Delete(dest string) error {
+	_, err := c.do(request{Op: opDelete, Object: dest}, nil, nil)
+	return err
+}
+
+// Exists checks if a blob exists through the daemon.
+func (c *Client) Exists(dest string) (bool, error) {
+	exists, _, err := c.ExistsWithReadPath(dest)
+	return exists, err
+}
+
+// ExistsWithReadPath checks if a blob exists through the daemon, also
+// returning the read path which answered.
+func (c *Client) ExistsWithReadPath(dest string) (bool, string, error) {
+	res, err := c.do(request{Op: opExists, Object: dest}, nil, nil)
+	if err != nil {
+		return false, "", err
+	}
+
+	if res.Exists {
+		log.Printf("File '%s' exists in bucket '%s'\n", dest, c.bucketName)
+	} else {
+		log.Printf("File '%s' does not exist in bucket '%s'\n", dest, c.bucketName)
+	}
+	return res.Exists, res.ReadPath, nil
+}
+
+// Sign generates a signed url through the daemon.
+func (c *Client) Sign(id string, action string, expiry time.Duration) (string, error) {
+	res, err := c.do(request{Op: opSign, Object: id, Action: action, Expiry: expiry}, nil, nil)
+	return res.URL, err
+}
+
+// do sends req over a new connection, streaming body as data if non-nil
+// and copying received data to out.
+func (c *Client) do(req request, body io.Reader, out io.Writer) (result, error) {
+	conn, err := net.Dial("unix", c.socket)
+	if err != nil {
+		return result{}, err
+	}
+	defer conn.Close() //nolint:errcheck
+
+	req.Config = c.fingerprint
+
+	writer := bufio.NewWriter(conn)
+	if err := writeJSONFrame(writer, frameRequest, req); err != nil {
+		return result{}, fmt.Errorf("sending request: %v", err)
+	}
+	if body != nil {
+		if _, err := io.Copy(&dataWriter{writer}, body); err != nil {
+			return result{}, fmt.Errorf("sending data: %v", err)
+		}
+		if err := writeFrame(writer, frameEnd, nil); err != nil {
+			return result{}, fmt.Errorf("sending data: %v", err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return result{}, fmt.Errorf("sending request: %v", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	for {
+		kind, payload, err := readFrame(reader)
+		if err != nil {
+			return result{}, fmt.Errorf("receiving response: %v", err)
+		}
+
+		switch kind {
+		case frameData:
+			if out == nil {
+				return result{}, fmt.Errorf("unexpected data for %s", req.Op)
+			}
+			if _, err := out.Write(payload); err != nil {
+				return result{}, err
+			}
+		case frameEnd:
+		case frameResult:
+			var res result
+			if err := json.Unmarshal(payload, &res); err != nil {
+				return result{}, fmt.Errorf("decoding result: %v", err)
+			}
+			return res, res.err()
+		default:
+			return result{}, fmt.Errorf("unexpected frame %q", kind)
+		}
+	}
+}
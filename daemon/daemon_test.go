@@ -0,0 +1,266 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package daemon_test
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+
+	"github.com/cloudfoundry/bosh-gcscli/client"
+	"github.com/cloudfoundry/bosh-gcscli/config"
+	. "github.com/cloudfoundry/bosh-gcscli/daemon"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// memoryBlobstore is a Blobstore keeping blobs in memory.
+type memoryBlobstore struct {
+	mu         sync.Mutex
+	blobs      map[string][]byte
+	putOptions map[string]client.PutOptions
+	getOptions client.GetOptions
+	readOnly   bool
+}
+
+func (m *memoryBlobstore) Put(src io.ReadSeeker, dest string) error {
+	if m.readOnly {
+		return client.ErrInvalidROWriteOperation
+	}
+	b, err := io.ReadAll(src)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.blobs[dest] = b
+	return nil
+}
+
+func (m *memoryBlobstore) PutWithOptions(src io.ReadSeeker, dest string, options client.PutOptions) error {
+	if err := m.Put(src, dest); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.putOptions[dest] = options
+	return nil
+}
+
+func (m *memoryBlobstore) PutWithResult(src io.ReadSeeker, dest string, options client.PutOptions) (bool, error) {
+	if options.SkipIfIdentical {
+		b, err := io.ReadAll(src)
+		if err != nil {
+			return false, err
+		}
+		m.mu.Lock()
+		stored, ok := m.blobs[dest]
+		m.mu.Unlock()
+		if ok && bytes.Equal(stored, b) {
+			return true, nil
+		}
+		if _, err := src.Seek(0, io.SeekStart); err != nil {
+			return false, err
+		}
+	}
+	return false, m.PutWithOptions(src, dest, options)
+}
+
+func (m *memoryBlobstore) Get(src string, dest io.Writer) error {
+	m.mu.Lock()
+	b, ok := m.blobs[src]
+	m.mu.Unlock()
+	if !ok {
+		return storage.ErrObjectNotExist
+	}
+	_, err := dest.Write(b)
+	return err
+}
+
+func (m *memoryBlobstore) Delete(dest string) error {
+	if m.readOnly {
+		return client.ErrInvalidROWriteOperation
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.blobs, dest)
+	return nil
+}
+
+func (m *memoryBlobstore) Exists(dest string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.blobs[dest]
+	return ok, nil
+}
+
+func (m *memoryBlobstore) GetWithReadPath(src string, dest io.Writer) (string, error) {
+	return client.PublicReadPath, m.Get(src, dest)
+}
+
+func (m *memoryBlobstore) GetWithOptions(src string, dest io.Writer, options client.GetOptions) (string, error) {
+	m.mu.Lock()
+	m.getOptions = options
+	m.mu.Unlock()
+	return m.GetWithReadPath(src, dest)
+}
+
+func (m *memoryBlobstore) ExistsWithReadPath(dest string) (bool, string, error) {
+	exists, err := m.Exists(dest)
+	return exists, client.PublicReadPath, err
+}
+
+func (m *memoryBlobstore) Sign(id string, action string, expiry time.Duration) (string, error) {
+	return "https://example.com/" + id + "?method=" + action + "&expiry=" + expiry.String(), nil
+}
+
+var _ = Describe("Daemon", func() {
+	var (
+		cfg       *config.GCSCli
+		blobstore *memoryBlobstore
+		socket    string
+		listener  net.Listener
+		served    chan error
+	)
+
+	BeforeEach(func() {
+		cfg = &config.GCSCli{BucketName: "some-bucket"}
+		blobstore = &memoryBlobstore{blobs: map[string][]byte{}, putOptions: map[string]client.PutOptions{}}
+
+		dir, err := os.MkdirTemp("", "gcscli-daemon")
+		Expect(err).ToNot(HaveOccurred())
+		DeferCleanup(os.RemoveAll, dir)
+		socket = filepath.Join(dir, "sock")
+
+		server, err := NewServer(blobstore, cfg)
+		Expect(err).ToNot(HaveOccurred())
+
+		listener, err = net.Listen("unix", socket)
+		Expect(err).ToNot(HaveOccurred())
+
+		served = make(chan error, 1)
+		go func() { served <- server.Serve(listener) }()
+	})
+
+	AfterEach(func() {
+		Expect(listener.Close()).To(Succeed())
+		Eventually(served).Should(Receive(BeNil()))
+	})
+
+	It("fails to dial a socket nobody listens on", func() {
+		_, err := Dial(socket+"-missing", cfg)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("refuses clients with a different configuration", func() {
+		_, err := Dial(socket, &config.GCSCli{BucketName: "other-bucket"})
+		Expect(err).To(MatchError(ErrConfigMismatch))
+	})
+
+	Context("with a matching configuration", func() {
+		var daemonClient *Client
+
+		BeforeEach(func() {
+			var err error
+			daemonClient, err = Dial(socket, cfg)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("performs the blobstore lifecycle", func() {
+			content := strings.Repeat("0123456789", 300000)
+			Expect(daemonClient.Put(strings.NewReader(content), "blob")).To(Succeed())
+
+			exists, err := daemonClient.Exists("blob")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(exists).To(BeTrue())
+
+			var fetched bytes.Buffer
+			Expect(daemonClient.Get("blob", &fetched)).To(Succeed())
+			Expect(fetched.String()).To(Equal(content))
+
+			Expect(daemonClient.Delete("blob")).To(Succeed())
+
+			exists, err = daemonClient.Exists("blob")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(exists).To(BeFalse())
+		})
+
+		It("forwards put options", func() {
+			customTime := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+			Expect(daemonClient.PutWithOptions(strings.NewReader("content"), "blob", client.PutOptions{CustomTime: customTime})).To(Succeed())
+			Expect(blobstore.putOptions["blob"].CustomTime).To(BeTemporally("==", customTime))
+		})
+
+		It("reports skipped uploads", func() {
+			Expect(daemonClient.Put(strings.NewReader("content"), "blob")).To(Succeed())
+
+			skipped, err := daemonClient.PutWithResult(strings.NewReader("content"), "blob", client.PutOptions{SkipIfIdentical: true})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(skipped).To(BeTrue())
+
+			skipped, err = daemonClient.PutWithResult(strings.NewReader("changed"), "blob", client.PutOptions{SkipIfIdentical: true})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(skipped).To(BeFalse())
+			Expect(blobstore.blobs["blob"]).To(Equal([]byte("changed")))
+		})
+
+		It("forwards get options", func() {
+			Expect(daemonClient.Put(strings.NewReader("content"), "blob")).To(Succeed())
+
+			var content bytes.Buffer
+			_, err := daemonClient.GetWithOptions("blob", &content, client.GetOptions{Raw: true})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(content.String()).To(Equal("content"))
+			Expect(blobstore.getOptions.Raw).To(BeTrue())
+		})
+
+		It("reports the read path", func() {
+			Expect(daemonClient.Put(strings.NewReader("content"), "blob")).To(Succeed())
+
+			readPath, err := daemonClient.GetWithReadPath("blob", io.Discard)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(readPath).To(Equal(client.PublicReadPath))
+
+			_, readPath, err = daemonClient.ExistsWithReadPath("blob")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(readPath).To(Equal(client.PublicReadPath))
+		})
+
+		It("signs urls", func() {
+			url, err := daemonClient.Sign("blob", "GET", time.Hour)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(url).To(Equal("https://example.com/blob?method=GET&expiry=1h0m0s"))
+		})
+
+		It("restores well-known errors", func() {
+			err := daemonClient.Get("missing", io.Discard)
+			Expect(err).To(MatchError(storage.ErrObjectNotExist))
+
+			blobstore.readOnly = true
+			err = daemonClient.Delete("blob")
+			Expect(err).To(MatchError(client.ErrInvalidROWriteOperation))
+		})
+	})
+})
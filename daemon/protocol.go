@@ -0,0 +1,213 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package daemon
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"cloud.google.com/go/storage"
+
+	"github.com/cloudfoundry/bosh-gcscli/client"
+	"github.com/cloudfoundry/bosh-gcscli/config"
+)
+
+// Every message exchanged over the socket is a frame: a one byte kind,
+// the payload length as a big-endian uint32 and the payload itself.
+//
+// A connection carries exactly one operation. The client sends a request
+// frame, followed for put by data frames and an end frame. The server
+// answers, for get, with data frames and an end frame, and always
+// finishes with a result frame.
+const (
+	frameRequest byte = 'Q'
+	frameData    byte = 'D'
+	frameEnd     byte = 'E'
+	frameResult  byte = 'R'
+)
+
+// maxFrameSize bounds the payload of a single frame.
+const maxFrameSize = 1 << 20
+
+// Operations understood by the server.
+const (
+	opHello  = "hello"
+	opPut    = "put"
+	opGet    = "get"
+	opDelete = "delete"
+	opExists = "exists"
+	opSign   = "sign"
+)
+
+// Error codes allowing the client to restore well-known errors.
+const (
+	codeConfigMismatch = "config_mismatch"
+	codeReadOnly       = "read_only"
+	codeNotFound       = "not_found"
+)
+
+// ErrConfigMismatch is returned when the daemon listening on a socket
+// serves a configuration different from the client's.
+var ErrConfigMismatch = errors.New("daemon serves a different configuration")
+
+type request struct {
+	Op         string             `json:"op"`
+	Config     string             `json:"config"`
+	Object     string             `json:"object,omitempty"`
+	Action     string             `json:"action,omitempty"`
+	Expiry     time.Duration      `json:"expiry,omitempty"`
+	PutOptions *client.PutOptions `json:"put_options,omitempty"`
+	GetOptions *client.GetOptions `json:"get_options,omitempty"`
+}
+
+type result struct {
+	Error    string `json:"error,omitempty"`
+	Code     string `json:"code,omitempty"`
+	Exists   bool   `json:"exists,omitempty"`
+	URL      string `json:"url,omitempty"`
+	ReadPath string `json:"read_path,omitempty"`
+	Skipped  bool   `json:"skipped,omitempty"`
+}
+
+// newResult returns the result of an operation which failed with err.
+func newResult(err error) result {
+	if err == nil {
+		return result{}
+	}
+
+	r := result{Error: err.Error()}
+	switch {
+	case errors.Is(err, ErrConfigMismatch):
+		r.Code = codeConfigMismatch
+	case errors.Is(err, client.ErrInvalidROWriteOperation):
+		r.Code = codeReadOnly
+	case errors.Is(err, storage.ErrObjectNotExist):
+		r.Code = codeNotFound
+	}
+	return r
+}
+
+// err restores the error of an operation from its result.
+func (r result) err() error {
+	switch {
+	case r.Code == codeConfigMismatch:
+		return ErrConfigMismatch
+	case r.Code == codeReadOnly:
+		return client.ErrInvalidROWriteOperation
+	case r.Code == codeNotFound:
+		return storage.ErrObjectNotExist
+	case r.Error != "":
+		return errors.New(r.Error)
+	}
+	return nil
+}
+
+// Fingerprint identifies cfg so that clients only use a daemon
+// serving the very same configuration.
+func Fingerprint(cfg *config.GCSCli) (string, error) {
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func writeFrame(w io.Writer, kind byte, payload []byte) error {
+	var header [5]byte
+	header[0] = kind
+	binary.BigEndian.PutUint32(header[1:], uint32(len(payload)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+func writeJSONFrame(w io.Writer, kind byte, v interface{}) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return writeFrame(w, kind, payload)
+}
+
+func readFrame(r io.Reader) (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > maxFrameSize {
+		return 0, nil, fmt.Errorf("frame of %d bytes exceeds limit of %d bytes", size, maxFrameSize)
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return header[0], payload, nil
+}
+
+// dataWriter sends everything written to it as data frames.
+type dataWriter struct {
+	w io.Writer
+}
+
+func (dw *dataWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > maxFrameSize {
+			chunk = chunk[:maxFrameSize]
+		}
+		if err := writeFrame(dw.w, frameData, chunk); err != nil {
+			return written, err
+		}
+		written += len(chunk)
+		p = p[len(chunk):]
+	}
+	return written, nil
+}
+
+// copyData reads data frames from r into w until an end frame is received.
+func copyData(w io.Writer, r io.Reader) error {
+	for {
+		kind, payload, err := readFrame(r)
+		if err != nil {
+			return err
+		}
+
+		switch kind {
+		case frameData:
+			if _, err := w.Write(payload); err != nil {
+				return err
+			}
+		case frameEnd:
+			return nil
+		default:
+			return fmt.Errorf("unexpected frame %q while reading data", kind)
+		}
+	}
+}
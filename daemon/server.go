@@ -0,0 +1,222 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package daemon
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry/bosh-gcscli/client"
+	"github.com/cloudfoundry/bosh-gcscli/config"
+)
+
+// SocketEnv is the environment variable holding the path of the socket
+// a daemon listens on. Invocations finding it set use the daemon.
+const SocketEnv = "BOSH_GCSCLI_SOCKET"
+
+// Blobstore is the set of operations a daemon serves.
+type Blobstore interface {
+	Put(src io.ReadSeeker, dest string) error
+	Get(src string, dest io.Writer) error
+	Delete(dest string) error
+	Exists(dest string) (bool, error)
+	Sign(id string, action string, expiry time.Duration) (string, error)
+}
+
+// OptionsPutter is implemented by a Blobstore which applies options to
+// the objects it uploads.
+type OptionsPutter interface {
+	PutWithOptions(src io.ReadSeeker, dest string, options client.PutOptions) error
+}
+
+// PutResultReporter is implemented by a Blobstore which reports whether
+// uploads were skipped, e.g. with client.PutOptions.SkipIfIdentical.
+type PutResultReporter interface {
+	PutWithResult(src io.ReadSeeker, dest string, options client.PutOptions) (bool, error)
+}
+
+// OptionsGetter is implemented by a Blobstore which applies options to
+// the reads of blobs.
+type OptionsGetter interface {
+	GetWithOptions(src string, dest io.Writer, options client.GetOptions) (string, error)
+}
+
+// ReadPathReporter is implemented by a Blobstore which reports the read
+// path, e.g. client.PublicReadPath, serving each read.
+type ReadPathReporter interface {
+	GetWithReadPath(src string, dest io.Writer) (string, error)
+	ExistsWithReadPath(dest string) (bool, string, error)
+}
+
+// Server executes operations received over a Unix socket using a single,
+// long-lived Blobstore, amortizing authentication and connection setup.
+type Server struct {
+	blobstore   Blobstore
+	fingerprint string
+	wg          sync.WaitGroup
+}
+
+// NewServer returns a Server executing operations with blobstore,
+// which must be configured by cfg.
+func NewServer(blobstore Blobstore, cfg *config.GCSCli) (*Server, error) {
+	fingerprint, err := Fingerprint(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{blobstore: blobstore, fingerprint: fingerprint}, nil
+}
+
+// Serve accepts connections on listener until it is closed, then waits for
+// in-flight operations to finish.
+func (s *Server) Serve(listener net.Listener) error {
+	defer s.wg.Wait()
+
+	for {
+		conn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close() //nolint:errcheck
+
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+
+	kind, payload, err := readFrame(reader)
+	if err != nil {
+		log.Printf("reading request: %v\n", err)
+		return
+	}
+
+	var req request
+	if kind != frameRequest {
+		err = fmt.Errorf("unexpected frame %q, expected a request", kind)
+	} else if err = json.Unmarshal(payload, &req); err == nil && req.Config != s.fingerprint {
+		err = ErrConfigMismatch
+	}
+
+	var res result
+	if err == nil {
+		res, err = s.execute(req, reader, writer)
+	}
+	if err != nil {
+		res = newResult(err)
+	}
+
+	if err := writeJSONFrame(writer, frameResult, res); err != nil {
+		log.Printf("writing result of %s: %v\n", req.Op, err)
+		return
+	}
+	if err := writer.Flush(); err != nil {
+		log.Printf("writing result of %s: %v\n", req.Op, err)
+	}
+}
+
+func (s *Server) execute(req request, reader io.Reader, writer io.Writer) (result, error) {
+	switch req.Op {
+	case opHello:
+		return result{}, nil
+	case opPut:
+		skipped, err := s.put(req.Object, req.PutOptions, reader)
+		return result{Skipped: skipped}, err
+	case opGet:
+		var res result
+		var err error
+		if req.GetOptions != nil {
+			if getter, ok := s.blobstore.(OptionsGetter); ok {
+				res.ReadPath, err = getter.GetWithOptions(req.Object, &dataWriter{writer}, *req.GetOptions)
+			} else {
+				err = errors.New("get options are not supported by the blobstore")
+			}
+		} else if reporter, ok := s.blobstore.(ReadPathReporter); ok {
+			res.ReadPath, err = reporter.GetWithReadPath(req.Object, &dataWriter{writer})
+		} else {
+			err = s.blobstore.Get(req.Object, &dataWriter{writer})
+		}
+		if endErr := writeFrame(writer, frameEnd, nil); err == nil {
+			err = endErr
+		}
+		return res, err
+	case opDelete:
+		return result{}, s.blobstore.Delete(req.Object)
+	case opExists:
+		if reporter, ok := s.blobstore.(ReadPathReporter); ok {
+			exists, readPath, err := reporter.ExistsWithReadPath(req.Object)
+			return result{Exists: exists, ReadPath: readPath}, err
+		}
+		exists, err := s.blobstore.Exists(req.Object)
+		return result{Exists: exists}, err
+	case opSign:
+		url, err := s.blobstore.Sign(req.Object, req.Action, req.Expiry)
+		return result{URL: url}, err
+	default:
+		return result{}, fmt.Errorf("unknown operation: '%s'", req.Op)
+	}
+}
+
+// put spools the uploaded content to a temporary file, as uploads need
+// to rewind their source when retrying. It reports whether the upload was
+// skipped.
+func (s *Server) put(dest string, options *client.PutOptions, reader io.Reader) (bool, error) {
+	spool, err := os.CreateTemp("", "bosh-gcscli-daemon")
+	if err != nil {
+		return false, fmt.Errorf("creating spool file: %v", err)
+	}
+	defer os.Remove(spool.Name()) //nolint:errcheck
+	defer spool.Close()           //nolint:errcheck
+
+	if err := copyData(spool, reader); err != nil {
+		return false, fmt.Errorf("receiving %s: %v", dest, err)
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return false, fmt.Errorf("rewinding spool file: %v", err)
+	}
+
+	if options == nil {
+		return false, s.blobstore.Put(spool, dest)
+	}
+	if reporter, ok := s.blobstore.(PutResultReporter); ok {
+		return reporter.PutWithResult(spool, dest, *options)
+	}
+	if options.SkipIfIdentical {
+		return false, errors.New("skipping identical uploads is not supported by the blobstore")
+	}
+	putter, ok := s.blobstore.(OptionsPutter)
+	if !ok {
+		return false, errors.New("put options are not supported by the blobstore")
+	}
+	return false, putter.PutWithOptions(spool, dest, *options)
+}
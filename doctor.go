@@ -0,0 +1,78 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/cloudfoundry/bosh-gcscli/client"
+)
+
+// doctorReport is the JSON form of the report printed by doctor.
+type doctorReport struct {
+	Passed bool           `json:"passed"`
+	Checks []client.Check `json:"checks"`
+}
+
+// runDoctor verifies the config and what it grants access to, printing
+// one line per check, or a JSON report with -output json.
+func runDoctor(ctx context.Context, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("doctor expected no arguments got %d", len(args))
+	}
+
+	var checks []client.Check
+	gcsConfig, err := readConfig()
+	if err != nil {
+		checks = append(checks, client.Check{Name: "config", Status: client.CheckFailed, Detail: err.Error()})
+	} else {
+		checks = append(checks, client.Check{Name: "config", Status: client.CheckPassed, Detail: fmt.Sprintf("bucket '%s'", gcsConfig.BucketName)})
+		checks = append(checks, client.Diagnose(ctx, &gcsConfig)...)
+	}
+
+	failed := 0
+	for _, check := range checks {
+		if check.Status == client.CheckFailed {
+			failed++
+		}
+	}
+
+	if *outputFormat == outputJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(doctorReport{Passed: failed == 0, Checks: checks}); err != nil {
+			return err
+		}
+	} else {
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, check := range checks {
+			fmt.Fprintf(writer, "%s\t%s\t%s\n", check.Status, check.Name, check.Detail) //nolint:errcheck
+		}
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/cloudfoundry/bosh-gcscli/client"
+)
+
+// errorCode classifies err into a short, stable code for
+// machine-readable output.
+func errorCode(err error) string {
+	var apiErr *googleapi.Error
+	var pathErr *fs.PathError
+
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, errInvalidOperation):
+		return "invalid_operation"
+	case errors.Is(err, client.ErrInvalidROWriteOperation):
+		return "read_only"
+	case errors.Is(err, client.ErrObjectHeld):
+		return "held"
+	case errors.Is(err, client.ErrObjectRetained):
+		return "retained"
+	case errors.Is(err, client.ErrNoReadCredentials):
+		return "no_credentials"
+	case errors.Is(err, client.ErrNotClientEncrypted), errors.Is(err, client.ErrClientDecryption):
+		return "decryption_failed"
+	case errors.Is(err, storage.ErrObjectNotExist), errors.Is(err, storage.ErrBucketNotExist):
+		return "not_found"
+	case errors.As(err, &apiErr):
+		return httpErrorCode(apiErr.Code)
+	case errors.As(err, &pathErr):
+		return "local_io"
+	}
+
+	if s, ok := status.FromError(err); ok {
+		switch s.Code() {
+		case codes.Unauthenticated, codes.PermissionDenied:
+			return "permission_denied"
+		case codes.NotFound:
+			return "not_found"
+		case codes.FailedPrecondition:
+			return "precondition_failed"
+		case codes.ResourceExhausted:
+			return "rate_limited"
+		case codes.Unavailable, codes.Internal, codes.DeadlineExceeded:
+			return "server_error"
+		}
+	}
+
+	return "unknown"
+}
+
+func httpErrorCode(code int) string {
+	switch {
+	case code == http.StatusUnauthorized, code == http.StatusForbidden:
+		return "permission_denied"
+	case code == http.StatusNotFound:
+		return "not_found"
+	case code == http.StatusPreconditionFailed:
+		return "precondition_failed"
+	case code == http.StatusTooManyRequests:
+		return "rate_limited"
+	case code >= http.StatusInternalServerError:
+		return "server_error"
+	}
+	return fmt.Sprintf("http_%d", code)
+}
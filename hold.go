@@ -0,0 +1,100 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/bosh-gcscli/client"
+	"github.com/cloudfoundry/bosh-gcscli/config"
+)
+
+// runHold places or releases the temporary and/or event-based hold of a blob.
+func runHold(ctx context.Context, cfg *config.GCSCli, args []string) error {
+	if len(args) == 0 || (args[0] != "set" && args[0] != "release") {
+		return errors.New("hold expected 'set' or 'release'")
+	}
+	held := args[0] == "set"
+
+	flags := flag.NewFlagSet("hold "+args[0], flag.ExitOnError)
+	var holds client.Holds
+	flags.BoolVar(&holds.Temporary, "temporary", false, "change the temporary hold")
+	flags.BoolVar(&holds.EventBased, "event-based", false, "change the event-based hold")
+	blobs, err := parseFlags(flags, args[1:])
+	if err != nil {
+		return err
+	}
+	if len(blobs) != 1 {
+		return fmt.Errorf("hold %s expected 1 blob got %d", args[0], len(blobs))
+	}
+	if !holds.Temporary && !holds.EventBased {
+		return errors.New("--temporary or --event-based is required")
+	}
+
+	blobstoreClient, err := client.New(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("creating gcs client: %v", err)
+	}
+	return blobstoreClient.SetHolds(blobs[0], holds, held)
+}
+
+// runRetention sets the retention of a blob.
+func runRetention(ctx context.Context, cfg *config.GCSCli, args []string) error {
+	if len(args) == 0 || args[0] != "set" {
+		return errors.New("retention expected 'set'")
+	}
+
+	flags := flag.NewFlagSet("retention set", flag.ExitOnError)
+	until := flags.String("until", "", "RFC 3339 timestamp until which the blob is retained (required)")
+	mode := flags.String("mode", "unlocked", "'unlocked' allows the retention to be reduced later with --override-unlocked, 'locked' does not")
+	override := flags.Bool("override-unlocked", false, "allow shortening or removing an unlocked retention")
+	blobs, err := parseFlags(flags, args[1:])
+	if err != nil {
+		return err
+	}
+	if len(blobs) != 1 {
+		return fmt.Errorf("retention set expected 1 blob got %d", len(blobs))
+	}
+	if *until == "" {
+		return errors.New("--until is required")
+	}
+	retainUntil, err := time.Parse(time.RFC3339, *until)
+	if err != nil {
+		return fmt.Errorf("invalid --until: %v", err)
+	}
+
+	var retentionMode string
+	switch strings.ToLower(*mode) {
+	case "unlocked":
+		retentionMode = client.UnlockedRetention
+	case "locked":
+		retentionMode = client.LockedRetention
+	default:
+		return fmt.Errorf("invalid --mode: %s must be unlocked or locked", *mode)
+	}
+
+	blobstoreClient, err := client.New(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("creating gcs client: %v", err)
+	}
+	return blobstoreClient.SetRetention(blobs[0], retentionMode, retainUntil, *override)
+}
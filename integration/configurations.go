@@ -78,9 +78,26 @@ func getBaseConfigs() []TableEntry {
 	regional := getRegionalConfig()
 	multiRegion := getMultiRegionConfig()
 
+	regionalGRPC := getRegionalConfig()
+	regionalGRPC.Transport = config.GRPCTransport
+
+	regionalFolder := getRegionalConfig()
+	regionalFolder.Folder = "bosh-gcscli-folder"
+
+	regionalProbe := getRegionalConfig()
+	regionalProbe.RemoteValidation = config.ObjectProbeRemoteValidation
+	regionalProbe.RemoteValidationTTL = "1m"
+
+	regionalAuthenticatedReads := getRegionalConfig()
+	regionalAuthenticatedReads.ReadStrategy = config.AuthenticatedOnlyReadStrategy
+
 	return []TableEntry{
 		Entry("Regional bucket, default StorageClass", regional),
 		Entry("MultiRegion bucket, default StorageClass", multiRegion),
+		Entry("Regional bucket, default StorageClass, gRPC transport", regionalGRPC),
+		Entry("Regional bucket, default StorageClass, folder", regionalFolder),
+		Entry("Regional bucket, default StorageClass, object-probe validation", regionalProbe),
+		Entry("Regional bucket, default StorageClass, authenticated-only reads", regionalAuthenticatedReads),
 	}
 }
 
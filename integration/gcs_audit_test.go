@@ -0,0 +1,112 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package integration
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Integration", func() {
+	Context("audit log", func() {
+		var env AssertContext
+		var auditLog string
+		BeforeEach(func() {
+			auditLog = filepath.Join(GinkgoT().TempDir(), "audit.jsonl")
+
+			cfg := getRegionalConfig()
+			cfg.AuditLog = auditLog
+
+			env = NewAssertContext(AsDefaultCredentials)
+			env.AddConfig(cfg)
+		})
+		AfterEach(func() {
+			env.Cleanup()
+		})
+
+		readRecords := func() []map[string]interface{} {
+			file, err := os.Open(auditLog)
+			Expect(err).ToNot(HaveOccurred())
+			defer file.Close() //nolint:errcheck
+
+			var records []map[string]interface{}
+			scanner := bufio.NewScanner(file)
+			for scanner.Scan() {
+				var record map[string]interface{}
+				Expect(json.Unmarshal(scanner.Bytes(), &record)).To(Succeed())
+				records = append(records, record)
+			}
+			return records
+		}
+
+		It("records put, copy and delete with their generations", func() {
+			session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "put", env.ContentFile, env.GCSFileName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+
+			session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "put", env.ContentFile, env.GCSFileName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+
+			copied := env.GCSFileName + "-copy"
+			session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "copy", env.GCSFileName, copied)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+
+			for _, blob := range []string{copied, env.GCSFileName} {
+				session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "delete", blob)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(session.ExitCode()).To(BeZero())
+			}
+
+			records := readRecords()
+			Expect(records).To(HaveLen(5))
+			for i, operation := range []string{"put", "put", "copy", "delete", "delete"} {
+				Expect(records[i]).To(HaveKeyWithValue("operation", operation))
+				Expect(records[i]).To(HaveKeyWithValue("outcome", "ok"))
+			}
+
+			Expect(records[0]).ToNot(HaveKey("generation_before"))
+			Expect(records[0]).To(HaveKey("crc32c"))
+			Expect(records[1]).To(HaveKeyWithValue("generation_before", records[0]["generation_after"]))
+			Expect(records[2]).To(HaveKeyWithValue("source", env.GCSFileName))
+			Expect(records[3]).To(HaveKeyWithValue("generation_before", records[2]["generation_after"]))
+			Expect(records[4]).To(HaveKeyWithValue("generation_before", records[1]["generation_after"]))
+		})
+
+		It("records failed operations", func() {
+			session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "put", "/does/not/exist", env.GCSFileName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).ToNot(BeZero())
+
+			session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "copy", env.GCSFileName+"-missing", env.GCSFileName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).ToNot(BeZero())
+
+			records := readRecords()
+			Expect(records).To(HaveLen(1))
+			Expect(records[0]).To(HaveKeyWithValue("operation", "copy"))
+			Expect(records[0]).To(HaveKeyWithValue("outcome", "failed"))
+			Expect(records[0]).To(HaveKey("error"))
+		})
+	})
+})
@@ -0,0 +1,64 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package integration
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Integration", func() {
+	Context("bandwidth limit", func() {
+		var env AssertContext
+		BeforeEach(func() {
+			cfg := getRegionalConfig()
+			cfg.MaxBandwidth = "16k"
+
+			env = NewAssertContext(AsDefaultCredentials)
+			env.AddConfig(cfg)
+		})
+		AfterEach(func() {
+			env.Cleanup()
+		})
+
+		It("throttles uploads", func() {
+			contentFile := MakeContentFile(GenerateRandomString(64 * 1024))
+
+			start := time.Now()
+			session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "put", contentFile, env.GCSFileName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+			defer RunGCSCLI(gcsCLIPath, env.ConfigPath, "delete", env.GCSFileName) //nolint:errcheck
+
+			// the first 16k are a burst, the remainder takes 3s
+			Expect(time.Since(start)).To(BeNumerically(">=", 3*time.Second))
+		})
+
+		It("is overridden by -limit-rate", func() {
+			session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "-limit-rate", "10MiB", "put", env.ContentFile, env.GCSFileName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+			defer RunGCSCLI(gcsCLIPath, env.ConfigPath, "delete", env.GCSFileName) //nolint:errcheck
+
+			session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "-limit-rate", "fast", "exists", env.GCSFileName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).ToNot(BeZero())
+		})
+	})
+})
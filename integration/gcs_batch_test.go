@@ -0,0 +1,113 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package integration
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry/bosh-gcscli/config"
+)
+
+var _ = Describe("Integration", func() {
+	Context("batch with general (Default Applicaton Credentials) configuration", func() {
+		var env AssertContext
+		BeforeEach(func() {
+			env = NewAssertContext(AsDefaultCredentials)
+		})
+		AfterEach(func() {
+			env.Cleanup()
+		})
+
+		configurations := getBaseConfigs()
+
+		DescribeTable("executes every operation of the manifest",
+			func(config *config.GCSCli) {
+				env.AddConfig(config)
+
+				tmpLocalFile, err := os.CreateTemp("", "gcscli-download")
+				Expect(err).ToNot(HaveOccurred())
+				defer os.Remove(tmpLocalFile.Name()) //nolint:errcheck
+				Expect(tmpLocalFile.Close()).To(Succeed())
+
+				copyName := env.GCSFileName + "-copy"
+				manifest := MakeContentFile(strings.Join([]string{
+					fmt.Sprintf(`{"op": "put", "src": %q, "dst": %q}`, env.ContentFile, env.GCSFileName),
+					fmt.Sprintf(`{"op": "put", "src": %q, "dst": %q}`, env.ContentFile, copyName),
+					fmt.Sprintf(`{"op": "exists", "blob": %q}`, env.GCSFileName+"-missing"),
+				}, "\n"))
+				defer os.Remove(manifest) //nolint:errcheck
+
+				session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "batch", "--parallelism", "2", manifest)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(session.ExitCode()).To(BeZero())
+
+				var results []map[string]interface{}
+				for _, line := range strings.Split(strings.TrimSpace(string(session.Out.Contents())), "\n") {
+					var result map[string]interface{}
+					Expect(json.Unmarshal([]byte(line), &result)).To(Succeed())
+					results = append(results, result)
+				}
+				Expect(results).To(HaveLen(3))
+				Expect(results).To(ContainElement(HaveKeyWithValue("exists", false)))
+				Expect(results).To(ContainElement(HaveKey("read_path")))
+
+				manifest2 := MakeContentFile(strings.Join([]string{
+					fmt.Sprintf(`{"op": "get", "src": %q, "dst": %q}`, env.GCSFileName, tmpLocalFile.Name()),
+					fmt.Sprintf(`{"op": "delete", "blob": %q}`, copyName),
+				}, "\n"))
+				defer os.Remove(manifest2) //nolint:errcheck
+
+				session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "batch", manifest2)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(session.ExitCode()).To(BeZero())
+
+				gottenBytes, err := os.ReadFile(tmpLocalFile.Name())
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(gottenBytes)).To(Equal(env.ExpectedString))
+
+				session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "delete", env.GCSFileName)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(session.ExitCode()).To(BeZero())
+			},
+			configurations)
+
+		It("leaves no file behind for a failed get and skips blank lines", func() {
+			env.AddConfig(getRegionalConfig())
+
+			dst := filepath.Join(GinkgoT().TempDir(), "download")
+			manifest := MakeContentFile(fmt.Sprintf(`{"op": "get", "src": %q, "dst": %q}`, env.GCSFileName+"-missing", dst) + "\n  \n")
+			defer os.Remove(manifest) //nolint:errcheck
+
+			session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "batch", manifest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).ToNot(BeZero())
+			Expect(strings.Split(strings.TrimSpace(string(session.Out.Contents())), "\n")).To(HaveLen(1))
+			Expect(string(session.Out.Contents())).To(ContainSubstring(`"error_code":"not_found"`))
+
+			entries, err := os.ReadDir(filepath.Dir(dst))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entries).To(BeEmpty())
+		})
+	})
+})
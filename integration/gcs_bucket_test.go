@@ -0,0 +1,104 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package integration
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry/bosh-gcscli/client"
+	"github.com/cloudfoundry/bosh-gcscli/config"
+)
+
+var _ = Describe("Integration", func() {
+	Context("bucket provisioning with general (Default Applicaton Credentials) configuration", func() {
+		var env AssertContext
+		var auditLog string
+		BeforeEach(func() {
+			auditLog = filepath.Join(GinkgoT().TempDir(), "audit.jsonl")
+
+			env = NewAssertContext(AsDefaultCredentials)
+			env.AddConfig(&config.GCSCli{
+				BucketName: strings.ToLower("bosh-gcs" + GenerateRandomString()),
+				AuditLog:   auditLog,
+			})
+		})
+		AfterEach(func() {
+			RunGCSCLI(gcsCLIPath, env.ConfigPath, "bucket", "delete", "--force") //nolint:errcheck
+			env.Cleanup()
+		})
+
+		It("creates, reconciles and deletes the bucket", func() {
+			session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "bucket", "ensure",
+				"--location", "us-east1", "--storage-class", "STANDARD", "--uniform-access")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+			Expect(session.Out.Contents()).To(ContainSubstring("' created"))
+
+			session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "bucket", "create", "--location", "us-east1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).ToNot(BeZero())
+			Expect(session.Err.Contents()).To(ContainSubstring(client.ErrBucketExists.Error()))
+
+			session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "bucket", "ensure",
+				"--location", "us-east1", "--storage-class", "STANDARD", "--uniform-access")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+			Expect(session.Out.Contents()).To(ContainSubstring("' unchanged"))
+
+			session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "bucket", "ensure", "--versioning")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+			Expect(session.Out.Contents()).To(ContainSubstring("' updated"))
+
+			session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "bucket", "ensure", "--location", "europe-west1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).ToNot(BeZero())
+			Expect(session.Err.Contents()).To(ContainSubstring(client.ErrBucketLocation.Error()))
+
+			session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "put", env.ContentFile, env.GCSFileName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+			session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "put", env.ContentFile, env.GCSFileName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+
+			session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "bucket", "delete")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).ToNot(BeZero())
+
+			session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "bucket", "delete", "--force")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+			Expect(session.Out.Contents()).To(ContainSubstring("' deleted"))
+
+			records, err := os.ReadFile(auditLog)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(strings.Count(string(records), `"operation":"delete"`)).To(Equal(2))
+			Expect(string(records)).To(ContainSubstring(`"operation":"delete-bucket"`))
+
+			session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "bucket", "delete")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+			Expect(session.Out.Contents()).To(ContainSubstring("' absent"))
+		})
+	})
+})
@@ -0,0 +1,97 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package integration
+
+import (
+	"strings"
+
+	"cloud.google.com/go/storage"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Integration", func() {
+	Context("bulk delete with general (Default Applicaton Credentials) configuration", func() {
+		var (
+			env    AssertContext
+			prefix string
+		)
+		BeforeEach(func() {
+			env = NewAssertContext(AsDefaultCredentials)
+			env.AddConfig(getRegionalConfig())
+
+			prefix = env.GCSFileName + "/"
+			for _, name := range []string{"a", "b"} {
+				session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "put", env.ContentFile, prefix+name)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(session.ExitCode()).To(BeZero())
+			}
+		})
+		AfterEach(func() {
+			RunGCSCLI(gcsCLIPath, env.ConfigPath, "delete", "--prefix", prefix, "--yes") //nolint:errcheck
+			env.Cleanup()
+		})
+
+		It("deletes a single blob whose name starts with '-'", func() {
+			blob := "-" + env.GCSFileName
+			sdk, err := newSDK(env.ctx, *env.Config)
+			Expect(err).ToNot(HaveOccurred())
+			writer := sdk.Bucket(env.Config.BucketName).Object(blob).NewWriter(env.ctx)
+			Expect(writer.Close()).To(Succeed())
+
+			session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "delete", blob)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+
+			_, err = sdk.Bucket(env.Config.BucketName).Object(blob).Attrs(env.ctx)
+			Expect(err).To(MatchError(storage.ErrObjectNotExist))
+		})
+
+		It("requires an explicit limit", func() {
+			session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "delete", "--prefix", prefix)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).ToNot(BeZero())
+		})
+
+		It("deletes nothing when more blobs than --max-objects match", func() {
+			session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "delete", "--prefix", prefix, "--max-objects", "1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).ToNot(BeZero())
+
+			session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "exists", prefix+"a")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+		})
+
+		It("deletes every blob below the prefix", func() {
+			session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "delete", "--prefix", prefix, "--dry-run")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+			Expect(strings.Count(string(session.Out.Contents()), `"status":"planned"`)).To(Equal(2))
+
+			session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "delete", "--prefix", prefix, "--max-objects", "2")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+			Expect(strings.Count(string(session.Out.Contents()), `"status":"ok"`)).To(Equal(2))
+
+			session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "exists", prefix+"a")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(Equal(3))
+		})
+	})
+})
@@ -0,0 +1,140 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package integration
+
+import (
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Integration", func() {
+	Context("cache configuration", func() {
+		var env AssertContext
+		AfterEach(func() {
+			env.Cleanup()
+		})
+
+		// getContent gets the blob through the cache and returns its content
+		getContent := func() string {
+			downloadFile := MakeContentFile("")
+			defer os.Remove(downloadFile) //nolint:errcheck
+
+			session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "get", env.GCSFileName, downloadFile)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+
+			content, err := os.ReadFile(downloadFile)
+			Expect(err).ToNot(HaveOccurred())
+			return string(content)
+		}
+
+		It("can perform cached lifecycle", func() {
+			cfg := getRegionalConfig()
+			cfg.CacheDir = GinkgoT().TempDir()
+
+			env = NewAssertContext(AsDefaultCredentials)
+			env.AddConfig(cfg)
+			AssertLifecycleWorks(gcsCLIPath, env)
+		})
+
+		It("serves the current generation of an overwritten blob", func() {
+			cfg := getRegionalConfig()
+			cfg.CacheDir = GinkgoT().TempDir()
+
+			env = NewAssertContext(AsDefaultCredentials)
+			env.AddConfig(cfg)
+
+			session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "put", env.ContentFile, env.GCSFileName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+			defer RunGCSCLI(gcsCLIPath, env.ConfigPath, "delete", env.GCSFileName) //nolint:errcheck
+			Expect(getContent()).To(Equal(env.ExpectedString))
+
+			overwritten := GenerateRandomString()
+			overwrittenFile := MakeContentFile(overwritten)
+			defer os.Remove(overwrittenFile) //nolint:errcheck
+			session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "put", overwrittenFile, env.GCSFileName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+
+			Expect(getContent()).To(Equal(overwritten))
+		})
+
+		It("serves cached blobs without reading them when immutable", func() {
+			cfg := getRegionalConfig()
+			cfg.CacheDir = GinkgoT().TempDir()
+			cfg.CacheImmutable = true
+
+			env = NewAssertContext(AsDefaultCredentials)
+			env.AddConfig(cfg)
+
+			session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "put", env.ContentFile, env.GCSFileName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+			Expect(getContent()).To(Equal(env.ExpectedString))
+
+			session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "delete", env.GCSFileName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+
+			Expect(getContent()).To(Equal(env.ExpectedString))
+		})
+
+		It("evicts the least recently used blobs", func() {
+			cfg := getRegionalConfig()
+			cfg.CacheDir = GinkgoT().TempDir()
+			cfg.CacheMaxSize = "1k"
+			cfg.CacheImmutable = true
+
+			env = NewAssertContext(AsDefaultCredentials)
+			env.AddConfig(cfg)
+
+			evicting := GenerateRandomString(1024)
+			evictingFile := MakeContentFile(evicting)
+			defer os.Remove(evictingFile) //nolint:errcheck
+			other := env.GCSFileName + "-other"
+
+			session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "put", env.ContentFile, env.GCSFileName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+			defer RunGCSCLI(gcsCLIPath, env.ConfigPath, "delete", env.GCSFileName) //nolint:errcheck
+			session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "put", evictingFile, other)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+			defer RunGCSCLI(gcsCLIPath, env.ConfigPath, "delete", other) //nolint:errcheck
+
+			Expect(getContent()).To(Equal(env.ExpectedString))
+			downloadFile := MakeContentFile("")
+			defer os.Remove(downloadFile) //nolint:errcheck
+			session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "get", other, downloadFile)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+
+			// The first blob was evicted, so it is read from the bucket
+			overwritten := GenerateRandomString()
+			overwrittenFile := MakeContentFile(overwritten)
+			defer os.Remove(overwrittenFile) //nolint:errcheck
+			session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "put", overwrittenFile, env.GCSFileName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+
+			Expect(getContent()).To(Equal(overwritten))
+		})
+	})
+})
@@ -0,0 +1,192 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package integration
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/cloudfoundry/bosh-gcscli/client"
+	"github.com/cloudfoundry/bosh-gcscli/config"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Integration", func() {
+	Context("client-side encryption configuration", func() {
+		var (
+			env AssertContext
+			cfg *config.GCSCli
+		)
+		BeforeEach(func() {
+			cfg = getRegionalConfig()
+			cfg.ClientEncryptionKey = append([]byte(nil), encryptionKeyBytes...)
+
+			env = NewAssertContext(AsDefaultCredentials)
+			env.AddConfig(cfg)
+		})
+		AfterEach(func() {
+			env.Cleanup()
+		})
+
+		It("can perform encrypted lifecycle", func() {
+			AssertLifecycleWorks(gcsCLIPath, env)
+		})
+
+		It("round-trips a blob spanning several chunks", func() {
+			content := GenerateRandomString(200 * 1024)
+			contentFile := MakeContentFile(content)
+			defer os.Remove(contentFile) //nolint:errcheck
+
+			session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "put", contentFile, env.GCSFileName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+			defer RunGCSCLI(gcsCLIPath, env.ConfigPath, "delete", env.GCSFileName) //nolint:errcheck
+
+			downloadFile := MakeContentFile("")
+			defer os.Remove(downloadFile) //nolint:errcheck
+
+			session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "get", env.GCSFileName, downloadFile)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+
+			downloaded, err := os.ReadFile(downloadFile)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(downloaded)).To(Equal(content))
+		})
+
+		It("stores the blob encrypted", func() {
+			session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "put", env.ContentFile, env.GCSFileName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+			defer RunGCSCLI(gcsCLIPath, env.ConfigPath, "delete", env.GCSFileName) //nolint:errcheck
+
+			sdk, err := newSDK(env.ctx, *env.Config)
+			Expect(err).ToNot(HaveOccurred())
+			reader, err := sdk.Bucket(env.Config.BucketName).Object(env.GCSFileName).NewReader(env.ctx)
+			Expect(err).ToNot(HaveOccurred())
+			defer reader.Close() //nolint:errcheck
+
+			stored, err := io.ReadAll(reader)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(stored)).ToNot(ContainSubstring(env.ExpectedString))
+		})
+
+		It("fails to get with the wrong client_encryption_key", func() {
+			session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "put", env.ContentFile, env.GCSFileName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+			defer RunGCSCLI(gcsCLIPath, env.ConfigPath, "delete", env.GCSFileName) //nolint:errcheck
+
+			env.Config.ClientEncryptionKey[0]++
+			blobstoreClient, err := client.New(env.ctx, env.Config)
+			Expect(err).ToNot(HaveOccurred())
+
+			var target bytes.Buffer
+			err = blobstoreClient.Get(env.GCSFileName, &target)
+			Expect(err).To(MatchError(client.ErrClientDecryption))
+		})
+
+		It("fails to get a blob written without client_encryption_key", func() {
+			key := env.Config.ClientEncryptionKey
+			env.Config.ClientEncryptionKey = nil
+			blobstoreClient, err := client.New(env.ctx, env.Config)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(blobstoreClient.Put(strings.NewReader(env.ExpectedString), env.GCSFileName)).To(Succeed())
+			defer blobstoreClient.Delete(env.GCSFileName) //nolint:errcheck
+
+			env.Config.ClientEncryptionKey = key
+			var target bytes.Buffer
+			err = blobstoreClient.Get(env.GCSFileName, &target)
+			Expect(err).To(MatchError(client.ErrNotClientEncrypted))
+		})
+
+		It("fails to get a blob moved to another name", func() {
+			session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "put", env.ContentFile, env.GCSFileName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+			defer RunGCSCLI(gcsCLIPath, env.ConfigPath, "delete", env.GCSFileName) //nolint:errcheck
+
+			moved := env.GCSFileName + "-moved"
+			sdk, err := newSDK(env.ctx, *env.Config)
+			Expect(err).ToNot(HaveOccurred())
+			bucket := sdk.Bucket(env.Config.BucketName)
+			_, err = bucket.Object(moved).CopierFrom(bucket.Object(env.GCSFileName)).Run(env.ctx)
+			Expect(err).ToNot(HaveOccurred())
+			defer RunGCSCLI(gcsCLIPath, env.ConfigPath, "delete", moved) //nolint:errcheck
+
+			blobstoreClient, err := client.New(env.ctx, env.Config)
+			Expect(err).ToNot(HaveOccurred())
+			var target bytes.Buffer
+			err = blobstoreClient.Get(moved, &target)
+			Expect(err).To(MatchError(client.ErrClientDecryption))
+		})
+
+		It("fails to get a blob whose compression metadata was modified", func() {
+			session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "put", env.ContentFile, env.GCSFileName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+			defer RunGCSCLI(gcsCLIPath, env.ConfigPath, "delete", env.GCSFileName) //nolint:errcheck
+
+			sdk, err := newSDK(env.ctx, *env.Config)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = sdk.Bucket(env.Config.BucketName).Object(env.GCSFileName).Update(env.ctx, storage.ObjectAttrsToUpdate{
+				Metadata: map[string]string{"bosh-gcscli-compression": "gzip"},
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			blobstoreClient, err := client.New(env.ctx, env.Config)
+			Expect(err).ToNot(HaveOccurred())
+			var target bytes.Buffer
+			err = blobstoreClient.Get(env.GCSFileName, &target)
+			Expect(err).To(MatchError(client.ErrClientDecryption))
+		})
+
+		It("copies a blob to a name it can be read from", func() {
+			session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "put", env.ContentFile, env.GCSFileName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+			defer RunGCSCLI(gcsCLIPath, env.ConfigPath, "delete", env.GCSFileName) //nolint:errcheck
+
+			copied := env.GCSFileName + "-copy"
+			session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "copy", env.GCSFileName, copied)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+			defer RunGCSCLI(gcsCLIPath, env.ConfigPath, "delete", copied) //nolint:errcheck
+
+			downloadFile := MakeContentFile("")
+			defer os.Remove(downloadFile) //nolint:errcheck
+
+			session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "get", copied, downloadFile)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+
+			downloaded, err := os.ReadFile(downloadFile)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(downloaded)).To(Equal(env.ExpectedString))
+		})
+
+		It("refuses to sign urls", func() {
+			session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "sign", env.GCSFileName, "get", "1h")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).ToNot(BeZero())
+		})
+	})
+})
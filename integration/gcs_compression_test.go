@@ -0,0 +1,130 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package integration
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+
+	"github.com/cloudfoundry/bosh-gcscli/client"
+	"github.com/cloudfoundry/bosh-gcscli/config"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Integration", func() {
+	Context("compression configuration", func() {
+		var env AssertContext
+		AfterEach(func() {
+			env.Cleanup()
+		})
+
+		DescribeTable("can perform compressed lifecycle",
+			func(compression string, encrypted bool) {
+				cfg := getRegionalConfig()
+				cfg.Compression = compression
+				if encrypted {
+					cfg.ClientEncryptionKey = append([]byte(nil), encryptionKeyBytes...)
+				}
+
+				env = NewAssertContext(AsDefaultCredentials)
+				env.AddConfig(cfg)
+				AssertLifecycleWorks(gcsCLIPath, env)
+			},
+			Entry("gzip", config.GzipCompression, false),
+			Entry("zstd", config.ZstdCompression, false),
+			Entry("gzip with client-side encryption", config.GzipCompression, true),
+		)
+	})
+
+	Context("general (Default Applicaton Credentials) configuration", func() {
+		var env AssertContext
+		BeforeEach(func() {
+			env = NewAssertContext(AsDefaultCredentials)
+			env.AddConfig(getRegionalConfig())
+		})
+		AfterEach(func() {
+			env.Cleanup()
+		})
+
+		It("compresses a single upload with put --compress", func() {
+			session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "put", "--compress", env.ContentFile, env.GCSFileName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+			defer RunGCSCLI(gcsCLIPath, env.ConfigPath, "delete", env.GCSFileName) //nolint:errcheck
+
+			sdk, err := newSDK(env.ctx, *env.Config)
+			Expect(err).ToNot(HaveOccurred())
+			attrs, err := sdk.Bucket(env.Config.BucketName).Object(env.GCSFileName).Attrs(env.ctx)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(attrs.ContentEncoding).To(Equal(config.GzipCompression))
+
+			downloadFile := MakeContentFile("")
+			defer os.Remove(downloadFile) //nolint:errcheck
+
+			session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "get", env.GCSFileName, downloadFile)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+			downloaded, err := os.ReadFile(downloadFile)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(downloaded)).To(Equal(env.ExpectedString))
+
+			session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "get", "--raw", env.GCSFileName, downloadFile)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+			downloaded, err = os.ReadFile(downloadFile)
+			Expect(err).ToNot(HaveOccurred())
+
+			reader, err := gzip.NewReader(bytes.NewReader(downloaded))
+			Expect(err).ToNot(HaveOccurred())
+			decompressed, err := io.ReadAll(reader)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(decompressed)).To(Equal(env.ExpectedString))
+		})
+	})
+
+	Context("zstd compression with static credentials", func() {
+		var env AssertContext
+		BeforeEach(func() {
+			cfg := getRegionalConfig()
+			cfg.Compression = config.ZstdCompression
+			env = NewAssertContext(AsStaticCredentials)
+			env.AddConfig(cfg)
+		})
+		AfterEach(func() {
+			RunGCSCLI(gcsCLIPath, env.ConfigPath, "delete", env.GCSFileName) //nolint:errcheck
+			env.Cleanup()
+		})
+
+		It("refuses to sign GET urls of compressed objects", func() {
+			session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "put", env.ContentFile, env.GCSFileName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+
+			session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "sign", env.GCSFileName, "get", "1h")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).ToNot(BeZero())
+			Expect(session.Err.Contents()).To(ContainSubstring(client.ErrZstdSign.Error()))
+
+			session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "sign", env.GCSFileName, "put", "1h")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+		})
+	})
+})
@@ -0,0 +1,75 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package integration
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry/bosh-gcscli/config"
+)
+
+var _ = Describe("Integration", func() {
+	Context("doctor", func() {
+		var env AssertContext
+		AfterEach(func() {
+			env.Cleanup()
+		})
+
+		It("passes every check with a static service account", func() {
+			env = NewAssertContext(AsStaticCredentials)
+			env.AddConfig(getRegionalConfig())
+
+			session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "doctor")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+			Expect(session.Out.Contents()).To(MatchRegexp(`pass\s+canary`))
+		})
+
+		It("fails for a storage class incompatible with the bucket location", func() {
+			cfg := getRegionalConfig()
+			cfg.StorageClass = "MULTI_REGIONAL"
+			env = NewAssertContext(AsStaticCredentials)
+			env.AddConfig(cfg)
+
+			session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "doctor")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).ToNot(BeZero())
+			Expect(session.Out.Contents()).To(MatchRegexp(`fail\s+storage_class`))
+		})
+
+		It("skips mutating checks without credentials", func() {
+			env = NewAssertContext(AsReadOnlyCredentials)
+			env.AddConfig(getPublicConfig())
+			Expect(env.Config.CredentialsSource).To(Equal(config.NoneCredentialsSource))
+
+			session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "doctor")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.Out.Contents()).To(MatchRegexp(`skip\s+canary`))
+		})
+
+		It("reports a config which cannot be read", func() {
+			env = NewAssertContext(AsStaticCredentials)
+			env.AddConfig(getRegionalConfig())
+
+			session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath+".missing", "doctor")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).ToNot(BeZero())
+			Expect(session.Out.Contents()).To(MatchRegexp(`fail\s+config`))
+		})
+	})
+})
@@ -105,4 +105,25 @@ var _ = Describe("Integration", func() {
 			Expect(session.ExitCode()).To(BeZero())
 		})
 	})
+
+	Context("gRPC transport configuration", func() {
+		var env AssertContext
+		BeforeEach(func() {
+			cfg := getMultiRegionConfig()
+			cfg.EncryptionKey = encryptionKeyBytes
+			cfg.Transport = config.GRPCTransport
+
+			env = NewAssertContext(AsDefaultCredentials)
+			env.AddConfig(cfg)
+		})
+		AfterEach(func() {
+			env.Cleanup()
+		})
+
+		// tests that a blob uploaded over gRPC with a specified encryption_key
+		// can be downloaded again.
+		It("can perform encrypted lifecycle", func() {
+			AssertLifecycleWorks(gcsCLIPath, env)
+		})
+	})
 })
@@ -124,6 +124,61 @@ var _ = Describe("Integration", func() {
 			})
 		})
 
+		Context("with a folder", func() {
+			BeforeEach(func() {
+				cfg := getRegionalConfig()
+				cfg.Folder = "bosh-gcscli-folder"
+				env.AddConfig(cfg)
+			})
+
+			It("stores blobs inside the folder", func() {
+				session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "put", env.ContentFile, env.GCSFileName)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(session.ExitCode()).To(BeZero())
+				defer RunGCSCLI(gcsCLIPath, env.ConfigPath, "delete", env.GCSFileName) //nolint:errcheck
+
+				rwClient, err := newSDK(env.ctx, *env.Config)
+				Expect(err).ToNot(HaveOccurred())
+				_, err = rwClient.Bucket(env.Config.BucketName).Object("bosh-gcscli-folder/" + env.GCSFileName).Attrs(env.ctx)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("rejects blob IDs escaping the folder", func() {
+				session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "put", env.ContentFile, "../"+env.GCSFileName)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(session.ExitCode()).ToNot(BeZero())
+				Expect(session.Err.Contents()).To(ContainSubstring(client.ErrInvalidBlobID.Error()))
+			})
+		})
+
+		Context("with read_only", func() {
+			BeforeEach(func() {
+				cfg := getRegionalConfig()
+				cfg.ReadOnly = true
+				env.AddConfig(cfg)
+			})
+
+			It("refuses to put", func() {
+				session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "put", env.ContentFile, env.GCSFileName)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(session.ExitCode()).ToNot(BeZero())
+				Expect(session.Err.Contents()).To(ContainSubstring(client.ErrInvalidROWriteOperation.Error()))
+			})
+
+			It("refuses to delete", func() {
+				session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "delete", env.GCSFileName)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(session.ExitCode()).ToNot(BeZero())
+				Expect(session.Err.Contents()).To(ContainSubstring(client.ErrInvalidROWriteOperation.Error()))
+			})
+
+			It("can still check if a blob exists", func() {
+				session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "exists", env.GCSFileName)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(session.ExitCode()).To(Equal(3))
+			})
+		})
+
 		DescribeTable("Invalid Put should fail",
 			func(config *config.GCSCli) {
 				env.AddConfig(config)
@@ -0,0 +1,85 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package integration
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry/bosh-gcscli/client"
+)
+
+var _ = Describe("Integration", func() {
+	Context("holds with general (Default Applicaton Credentials) configuration", func() {
+		var env AssertContext
+		BeforeEach(func() {
+			env = NewAssertContext(AsDefaultCredentials)
+			env.AddConfig(getRegionalConfig())
+
+			session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "put", "--custom-time", "2026-01-02T03:04:05Z", env.ContentFile, env.GCSFileName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+		})
+		AfterEach(func() {
+			RunGCSCLI(gcsCLIPath, env.ConfigPath, "hold", "release", "--temporary", "--event-based", env.GCSFileName) //nolint:errcheck
+			RunGCSCLI(gcsCLIPath, env.ConfigPath, "delete", env.GCSFileName)                                          //nolint:errcheck
+			env.Cleanup()
+		})
+
+		It("sets the custom time", func() {
+			session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "stat", env.GCSFileName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+			Expect(session.Out.Contents()).To(MatchRegexp(`custom_time\s+2026-01-02T03:04:05Z`))
+		})
+
+		It("refuses to delete a held blob until the hold is released", func() {
+			session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "hold", "set", "--temporary", env.GCSFileName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+
+			session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "stat", env.GCSFileName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.Out.Contents()).To(MatchRegexp(`temporary_hold\s+true`))
+
+			session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "delete", env.GCSFileName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).ToNot(BeZero())
+			Expect(session.Err.Contents()).To(ContainSubstring(client.ErrObjectHeld.Error()))
+
+			session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "hold", "release", "--temporary", env.GCSFileName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+
+			session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "delete", env.GCSFileName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+		})
+
+		It("reports holds in the metadata", func() {
+			session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "hold", "set", "--event-based", env.GCSFileName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+
+			session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "stat", env.GCSFileName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+			Expect(session.Out.Contents()).To(MatchRegexp(`event_based_hold\s+true`))
+			Expect(session.Out.Contents()).To(MatchRegexp(`temporary_hold\s+false`))
+		})
+	})
+})
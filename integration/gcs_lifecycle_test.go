@@ -0,0 +1,72 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package integration
+
+import (
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry/bosh-gcscli/client"
+)
+
+var _ = Describe("Integration", func() {
+	Context("bucket lifecycle with general (Default Applicaton Credentials) configuration", func() {
+		var env AssertContext
+		BeforeEach(func() {
+			env = NewAssertContext(AsDefaultCredentials)
+			env.AddConfig(getRegionalConfig())
+		})
+		AfterEach(func() {
+			RunGCSCLI(gcsCLIPath, env.ConfigPath, "bucket", "lifecycle", "clear") //nolint:errcheck
+			env.Cleanup()
+		})
+
+		It("sets, gets and clears the rules", func() {
+			rules := MakeContentFile(`{"rule": [{"action": {"type": "Delete"}, "condition": {"isLive": false, "daysSinceNoncurrentTime": 30}}]}`)
+			defer os.Remove(rules) //nolint:errcheck
+
+			session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "bucket", "lifecycle", "set", rules)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+
+			session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "bucket", "lifecycle", "get")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+			Expect(session.Out.Contents()).To(ContainSubstring(`"daysSinceNoncurrentTime": 30`))
+
+			session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "bucket", "lifecycle", "clear")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+
+			session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "bucket", "lifecycle", "get")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.Out.Contents()).ToNot(ContainSubstring("Delete"))
+		})
+
+		It("rejects invalid rules", func() {
+			rules := MakeContentFile(`{"rule": [{"action": {"type": "SetStorageClass", "storageClass": "FREEZER"}, "condition": {"age": 30}}]}`)
+			defer os.Remove(rules) //nolint:errcheck
+
+			session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "bucket", "lifecycle", "set", rules)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).ToNot(BeZero())
+			Expect(session.Err.Contents()).To(ContainSubstring(client.ErrInvalidLifecycle.Error()))
+		})
+	})
+})
@@ -0,0 +1,60 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package integration
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Integration", func() {
+	Context("general (Default Applicaton Credentials) configuration", func() {
+		var env AssertContext
+		BeforeEach(func() {
+			env = NewAssertContext(AsDefaultCredentials)
+			env.AddConfig(getRegionalConfig())
+		})
+		AfterEach(func() {
+			env.Cleanup()
+		})
+
+		It("reports the progress of transfers as NDJSON when stderr is not a terminal", func() {
+			session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "put", "--progress", env.ContentFile, env.GCSFileName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+			defer RunGCSCLI(gcsCLIPath, env.ConfigPath, "delete", env.GCSFileName) //nolint:errcheck
+
+			var last map[string]interface{}
+			scanner := bufio.NewScanner(bytes.NewReader(session.Err.Contents()))
+			for scanner.Scan() {
+				var event map[string]interface{}
+				if json.Unmarshal(scanner.Bytes(), &event) == nil && event["event"] == "progress" {
+					last = event
+				}
+			}
+			Expect(last).ToNot(BeNil())
+			Expect(last["op"]).To(Equal("put"))
+			Expect(last["done"]).To(BeTrue())
+			Expect(last["bytes"]).To(BeNumerically("==", len(env.ExpectedString)))
+			Expect(last["total"]).To(BeNumerically("==", len(env.ExpectedString)))
+		})
+	})
+})
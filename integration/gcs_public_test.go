@@ -104,6 +104,13 @@ var _ = Describe("GCS Public Bucket", func() {
 			Expect(session.Err.Contents()).To(ContainSubstring(client.ErrInvalidROWriteOperation.Error()))
 		})
 
+		It("fails to delete by prefix", func() {
+			session, err := RunGCSCLI(gcsCLIPath, publicEnv.ConfigPath, "delete", "--prefix", publicEnv.GCSFileName, "--yes")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).ToNot(BeZero())
+			Expect(session.Err.Contents()).To(ContainSubstring(client.ErrInvalidROWriteOperation.Error()))
+		})
+
 		It("fails to delete", func() {
 			session, err := RunGCSCLI(gcsCLIPath, publicEnv.ConfigPath, "delete", publicEnv.GCSFileName)
 			Expect(err).ToNot(HaveOccurred())
@@ -0,0 +1,147 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+
+	"cloud.google.com/go/storage"
+
+	"github.com/cloudfoundry/bosh-gcscli/config"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Integration", func() {
+	Context("secondary bucket", func() {
+		var env AssertContext
+		var secondaryBucket string
+		AfterEach(func() {
+			env.Cleanup()
+		})
+
+		newReplicatedConfig := func(replication string) *config.GCSCli {
+			cfg := getRegionalConfig()
+			secondaryBucket = getMultiRegionConfig().BucketName
+			cfg.Secondary = &config.SecondaryBucket{BucketName: secondaryBucket}
+			cfg.Replication = replication
+			return cfg
+		}
+
+		// secondaryAttrs returns the attributes of the blob in the
+		// secondary bucket
+		secondaryAttrs := func(blob string) (*storage.ObjectAttrs, error) {
+			sdk, err := newSDK(env.ctx, *env.Config)
+			Expect(err).ToNot(HaveOccurred())
+			return sdk.Bucket(secondaryBucket).Object(blob).Attrs(env.ctx)
+		}
+
+		DescribeTable("replicates put, copy and delete",
+			func(replication string) {
+				env = NewAssertContext(AsDefaultCredentials)
+				env.AddConfig(newReplicatedConfig(replication))
+
+				session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "put", env.ContentFile, env.GCSFileName)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(session.ExitCode()).To(BeZero())
+				_, err = secondaryAttrs(env.GCSFileName)
+				Expect(err).ToNot(HaveOccurred())
+
+				copied := env.GCSFileName + "-copy"
+				session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "copy", env.GCSFileName, copied)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(session.ExitCode()).To(BeZero())
+				_, err = secondaryAttrs(copied)
+				Expect(err).ToNot(HaveOccurred())
+
+				session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "replicate", "verify", env.GCSFileName)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(session.ExitCode()).To(BeZero())
+
+				for _, blob := range []string{env.GCSFileName, copied} {
+					session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "delete", blob)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(session.ExitCode()).To(BeZero())
+					_, err = secondaryAttrs(blob)
+					Expect(errors.Is(err, storage.ErrObjectNotExist)).To(BeTrue())
+				}
+			},
+			Entry("all", config.AllReplication),
+			Entry("primary-then-async", config.PrimaryThenAsyncReplication),
+		)
+
+		It("fails over reads to the secondary bucket", func() {
+			secondaryKey := bytes.Repeat([]byte{7}, 32)
+
+			cfg := newReplicatedConfig(config.AllReplication)
+			cfg.EncryptionKey = append([]byte(nil), encryptionKeyBytes...)
+			cfg.Secondary.EncryptionKey = secondaryKey
+			env = NewAssertContext(AsDefaultCredentials)
+			env.AddConfig(cfg)
+
+			session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "put", env.ContentFile, env.GCSFileName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+			defer RunGCSCLI(gcsCLIPath, env.ConfigPath, "delete", env.GCSFileName) //nolint:errcheck
+
+			// The primary bucket cannot be read with the wrong key
+			failing := newReplicatedConfig(config.AllReplication)
+			failing.EncryptionKey = bytes.Repeat([]byte{9}, 32)
+			failing.Secondary.EncryptionKey = secondaryKey
+			failingConfigPath := MakeConfigFile(failing)
+			defer os.Remove(failingConfigPath) //nolint:errcheck
+
+			downloadFile := MakeContentFile("")
+			defer os.Remove(downloadFile) //nolint:errcheck
+			session, err = RunGCSCLI(gcsCLIPath, failingConfigPath, "-output", "json", "get", env.GCSFileName, downloadFile)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+
+			var result struct {
+				ReadPath string `json:"read_path"`
+			}
+			Expect(json.Unmarshal(session.Out.Contents(), &result)).To(Succeed())
+			Expect(result.ReadPath).To(HavePrefix("secondary-"))
+
+			content, err := os.ReadFile(downloadFile)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(content)).To(Equal(env.ExpectedString))
+		})
+
+		It("reports divergent blobs", func() {
+			env = NewAssertContext(AsDefaultCredentials)
+			env.AddConfig(newReplicatedConfig(config.AllReplication))
+
+			session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "put", env.ContentFile, env.GCSFileName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+			defer RunGCSCLI(gcsCLIPath, env.ConfigPath, "delete", env.GCSFileName) //nolint:errcheck
+
+			sdk, err := newSDK(env.ctx, *env.Config)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sdk.Bucket(secondaryBucket).Object(env.GCSFileName).Delete(env.ctx)).To(Succeed())
+
+			session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "replicate", "verify", env.GCSFileName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).ToNot(BeZero())
+			Expect(session.Out.Contents()).To(ContainSubstring(`{"blob":"` + env.GCSFileName + `","reason":"missing_secondary"}`))
+		})
+	})
+})
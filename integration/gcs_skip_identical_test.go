@@ -0,0 +1,126 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package integration
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/cloudfoundry/bosh-gcscli/config"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Integration", func() {
+	Context("put --skip-if-identical", func() {
+		var env AssertContext
+		AfterEach(func() {
+			env.Cleanup()
+		})
+
+		// putStatus puts file with -output json and returns its status
+		putStatus := func(file string, args ...string) string {
+			args = append(append([]string{"put"}, args...), file, env.GCSFileName)
+			session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "-output", append([]string{"json"}, args...)...)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+
+			var result struct {
+				Status string `json:"status"`
+			}
+			Expect(json.Unmarshal(session.Out.Contents(), &result)).To(Succeed())
+			return result.Status
+		}
+
+		DescribeTable("skips identical blobs",
+			func(compression string, encrypted bool) {
+				cfg := getRegionalConfig()
+				cfg.Compression = compression
+				if encrypted {
+					cfg.ClientEncryptionKey = append([]byte(nil), encryptionKeyBytes...)
+				}
+
+				env = NewAssertContext(AsDefaultCredentials)
+				env.AddConfig(cfg)
+				defer RunGCSCLI(gcsCLIPath, env.ConfigPath, "delete", env.GCSFileName) //nolint:errcheck
+
+				Expect(putStatus(env.ContentFile, "--skip-if-identical")).To(Equal("ok"))
+				Expect(putStatus(env.ContentFile, "--skip-if-identical")).To(Equal("skipped"))
+
+				changedFile := MakeContentFile(GenerateRandomString())
+				defer os.Remove(changedFile) //nolint:errcheck
+				Expect(putStatus(changedFile, "--skip-if-identical")).To(Equal("ok"))
+			},
+			Entry("stored as is", "", false),
+			Entry("compressed", config.GzipCompression, false),
+			Entry("client-side encrypted", "", true),
+		)
+
+		It("overwrites identical blobs without it", func() {
+			env = NewAssertContext(AsDefaultCredentials)
+			env.AddConfig(getRegionalConfig())
+			defer RunGCSCLI(gcsCLIPath, env.ConfigPath, "delete", env.GCSFileName) //nolint:errcheck
+
+			Expect(putStatus(env.ContentFile)).To(Equal("ok"))
+			Expect(putStatus(env.ContentFile)).To(Equal("ok"))
+		})
+
+		It("defaults to skip_if_identical", func() {
+			cfg := getRegionalConfig()
+			cfg.SkipIfIdentical = true
+
+			env = NewAssertContext(AsDefaultCredentials)
+			env.AddConfig(cfg)
+			defer RunGCSCLI(gcsCLIPath, env.ConfigPath, "delete", env.GCSFileName) //nolint:errcheck
+
+			Expect(putStatus(env.ContentFile)).To(Equal("ok"))
+			Expect(putStatus(env.ContentFile)).To(Equal("skipped"))
+			Expect(putStatus(env.ContentFile, "--skip-if-identical=false")).To(Equal("ok"))
+		})
+
+		It("skips identical blobs put by batch with skip_if_identical", func() {
+			cfg := getRegionalConfig()
+			cfg.SkipIfIdentical = true
+
+			env = NewAssertContext(AsDefaultCredentials)
+			env.AddConfig(cfg)
+			defer RunGCSCLI(gcsCLIPath, env.ConfigPath, "delete", env.GCSFileName) //nolint:errcheck
+
+			line, err := json.Marshal(map[string]string{"op": "put", "src": env.ContentFile, "dst": env.GCSFileName})
+			Expect(err).ToNot(HaveOccurred())
+			manifest := MakeContentFile(string(line) + "\n")
+			defer os.Remove(manifest) //nolint:errcheck
+
+			Expect(putStatus(env.ContentFile)).To(Equal("ok"))
+
+			session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "batch", manifest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+			Expect(string(session.Out.Contents())).To(ContainSubstring(`"status":"skipped"`))
+		})
+
+		It("uploads when the compression differs", func() {
+			env = NewAssertContext(AsDefaultCredentials)
+			env.AddConfig(getRegionalConfig())
+			defer RunGCSCLI(gcsCLIPath, env.ConfigPath, "delete", env.GCSFileName) //nolint:errcheck
+
+			Expect(putStatus(env.ContentFile)).To(Equal("ok"))
+			Expect(putStatus(env.ContentFile, "--skip-if-identical", "--compress")).To(Equal("ok"))
+			Expect(putStatus(env.ContentFile, "--skip-if-identical", "--compress")).To(Equal("skipped"))
+		})
+	})
+})
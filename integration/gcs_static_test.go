@@ -70,6 +70,23 @@ var _ = Describe("Integration", func() {
 			defer resp.Body.Close() //nolint:errcheck
 		})
 
+		Context("read_only is set", func() {
+			BeforeEach(func() {
+				cfg.ReadOnly = true
+				ctx.AddConfig(cfg)
+			})
+
+			It("only signs GET urls", func() {
+				session, err := RunGCSCLI(gcsCLIPath, ctx.ConfigPath, "sign", ctx.GCSFileName, "get", "1h")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(session.ExitCode()).To(BeZero())
+
+				session, err = RunGCSCLI(gcsCLIPath, ctx.ConfigPath, "sign", ctx.GCSFileName, "put", "1h")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(session.ExitCode()).ToNot(BeZero())
+			})
+		})
+
 		Context("encryption key is set", func() {
 			var key string
 
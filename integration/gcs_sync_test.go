@@ -0,0 +1,131 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package integration
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry/bosh-gcscli/config"
+)
+
+var _ = Describe("Integration", func() {
+	Context("sync with general (Default Applicaton Credentials) configuration", func() {
+		var (
+			env      AssertContext
+			localDir string
+			prefix   string
+		)
+		BeforeEach(func() {
+			env = NewAssertContext(AsDefaultCredentials)
+			env.AddConfig(getRegionalConfig())
+
+			var err error
+			localDir, err = os.MkdirTemp("", "gcscli-sync")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(os.MkdirAll(filepath.Join(localDir, "nested"), 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(localDir, "top"), []byte(env.ExpectedString), 0644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(localDir, "nested", "inner"), []byte(GenerateRandomString()), 0644)).To(Succeed())
+
+			prefix = env.GCSFileName
+		})
+		AfterEach(func() {
+			RunGCSCLI(gcsCLIPath, env.ConfigPath, "delete", prefix+"/top")          //nolint:errcheck
+			RunGCSCLI(gcsCLIPath, env.ConfigPath, "delete", prefix+"/nested/inner") //nolint:errcheck
+			os.RemoveAll(localDir)                                                  //nolint:errcheck
+			env.Cleanup()
+		})
+
+		It("transfers only differences in both directions", func() {
+			session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "sync", "--upload", "--dry-run", localDir, prefix)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+			Expect(strings.Count(string(session.Out.Contents()), `"action":"upload"`)).To(Equal(2))
+
+			session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "sync", "--upload", localDir, prefix)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+
+			session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "sync", "--upload", "--dry-run", localDir, prefix)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+			Expect(session.Out.Contents()).To(BeEmpty())
+
+			downloadDir := filepath.Join(localDir, "..", filepath.Base(localDir)+"-download")
+			defer os.RemoveAll(downloadDir) //nolint:errcheck
+
+			session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "sync", "--download", prefix, downloadDir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+
+			gottenBytes, err := os.ReadFile(filepath.Join(downloadDir, "top"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(gottenBytes)).To(Equal(env.ExpectedString))
+			Expect(filepath.Join(downloadDir, "nested", "inner")).To(BeARegularFile())
+
+			// Downloaded files have the mode of files written by get
+			reference := filepath.Join(downloadDir, "reference")
+			referenceFile, err := os.Create(reference)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(referenceFile.Close()).To(Succeed())
+			referenceInfo, err := os.Stat(reference)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(os.Remove(reference)).To(Succeed())
+			downloadedInfo, err := os.Stat(filepath.Join(downloadDir, "top"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(downloadedInfo.Mode().Perm()).To(Equal(referenceInfo.Mode().Perm()))
+
+			Expect(os.Remove(filepath.Join(localDir, "top"))).To(Succeed())
+			session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "sync", "--upload", "--delete", "--dry-run", localDir, prefix)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+			Expect(string(session.Out.Contents())).To(ContainSubstring(`"reason":"extraneous"`))
+		})
+
+		It("compares compressed blobs by the files uploaded", func() {
+			env.Config.Compression = config.ZstdCompression
+			os.Remove(env.ConfigPath) //nolint:errcheck
+			env.ConfigPath = MakeConfigFile(env.Config)
+
+			session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "sync", "--upload", localDir, prefix)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+
+			session, err = RunGCSCLI(gcsCLIPath, env.ConfigPath, "sync", "--upload", "--dry-run", localDir, prefix)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).To(BeZero())
+			Expect(session.Out.Contents()).To(BeEmpty())
+		})
+
+		It("refuses to upload a missing local directory", func() {
+			session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "sync", "--upload", "--delete", localDir+"-missing", prefix)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).ToNot(BeZero())
+			Expect(session.Out.Contents()).To(BeEmpty())
+		})
+
+		It("requires the direction", func() {
+			session, err := RunGCSCLI(gcsCLIPath, env.ConfigPath, "sync", localDir, prefix)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.ExitCode()).ToNot(BeZero())
+		})
+	})
+})
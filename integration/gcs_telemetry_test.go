@@ -0,0 +1,69 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package integration
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudfoundry/bosh-gcscli/config"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+)
+
+var _ = Describe("Integration", func() {
+	Context("file telemetry exporter", func() {
+		var (
+			env           AssertContext
+			telemetryFile string
+		)
+		BeforeEach(func() {
+			telemetryFile = filepath.Join(GinkgoT().TempDir(), "telemetry.json")
+
+			cfg := getRegionalConfig()
+			cfg.TelemetryExporter = config.FileTelemetryExporter
+			cfg.TelemetryFile = telemetryFile
+
+			env = NewAssertContext(AsDefaultCredentials)
+			env.AddConfig(cfg)
+		})
+		AfterEach(func() {
+			env.Cleanup()
+		})
+
+		It("records spans in the trace of TRACEPARENT and metrics", func() {
+			traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+			command := exec.Command(gcsCLIPath, "-c", env.ConfigPath, "put", env.ContentFile, env.GCSFileName)
+			command.Env = append(os.Environ(), "TRACEPARENT=00-"+traceID+"-00f067aa0ba902b7-01")
+			session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+			Expect(err).ToNot(HaveOccurred())
+			session.Wait(1 * time.Minute)
+			Expect(session.ExitCode()).To(BeZero())
+			defer RunGCSCLI(gcsCLIPath, env.ConfigPath, "delete", env.GCSFileName) //nolint:errcheck
+
+			telemetry, err := os.ReadFile(telemetryFile)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(telemetry)).To(ContainSubstring(`"Name":"gcscli.put"`))
+			Expect(string(telemetry)).To(ContainSubstring(`"TraceID":"` + traceID + `"`))
+			Expect(string(telemetry)).To(ContainSubstring(`"Name":"gcscli.operation.duration"`))
+			Expect(string(telemetry)).To(ContainSubstring(`"Name":"gcscli.transferred"`))
+		})
+	})
+})
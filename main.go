@@ -28,6 +28,7 @@ import (
 
 	"github.com/cloudfoundry/bosh-gcscli/client"
 	"github.com/cloudfoundry/bosh-gcscli/config"
+	"github.com/cloudfoundry/bosh-gcscli/daemon"
 )
 
 var version = "dev"
@@ -38,17 +39,69 @@ const usageExample = `
 bosh-gcscli --help
 
 # Upload a blob to the GCS blobstore.
-bosh-gcscli -c config.json put <path/to/file> <remote-blob>
+# Where:
+# - --custom-time is an RFC 3339 timestamp set as the object's custom time
+# - --compress compresses the blob with the configured compression, or gzip
+# - --progress reports the progress of the upload on stderr
+# - --skip-if-identical skips the upload if the blob already holds the
+#   file, defaulting to skip_if_identical in the config
+bosh-gcscli -c config.json [-output json] put [--custom-time <time>] [--compress] [--progress] [--skip-if-identical] <path/to/file> <remote-blob>
 
 # Fetch a blob from the GCS blobstore.
 # Destination file will be overwritten if exists.
-bosh-gcscli -c config.json get <remote-blob> <path/to/file>
-
-# Remove a blob from the GCS blobstore.
-bosh-gcscli -c config.json delete <remote-blob>
+# Compressed blobs are decompressed unless --raw is given.
+# With -output json, a JSON result naming the read path, 'public' or
+# 'authenticated', is printed.
+# With --progress, the progress of the download is reported on stderr, as a
+# bar on a terminal, or as NDJSON events otherwise or with -output json.
+bosh-gcscli -c config.json [-output json] get [--raw] [--progress] <remote-blob> <path/to/file>
+
+# Remove a blob from the GCS blobstore. A blob whose name starts with '-'
+# is given after '--'.
+bosh-gcscli -c config.json delete [--] <remote-blob>
+
+# Remove every blob below a prefix, or named in a file ('-' for stdin),
+# printing one NDJSON result per blob.
+# Where:
+# - --yes or --max-objects <n> is required, the latter refusing to delete
+#   anything if more than <n> blobs match
+# - --dry-run prints the blobs which would be deleted
+bosh-gcscli -c config.json delete --prefix <prefix> (--yes | --max-objects <n>) [--dry-run] [--parallelism <n>]
+bosh-gcscli -c config.json delete --from-file <path/to/list> (--yes | --max-objects <n>) [--dry-run] [--parallelism <n>]
 
 # Checks if blob exists in the GCS blobstore.
-bosh-gcscli -c config.json exists <remote-blob>
+bosh-gcscli -c config.json [-output json] exists <remote-blob>
+
+# Print the metadata of a blob, including its holds and retention.
+bosh-gcscli -c config.json [-output json] stat <remote-blob>
+
+# Place or release the temporary and/or event-based hold of a blob.
+bosh-gcscli -c config.json hold (set | release) [--temporary] [--event-based] <remote-blob>
+
+# Retain a blob until an RFC 3339 timestamp. Shortening an unlocked
+# retention requires --override-unlocked; a locked one can only be extended.
+bosh-gcscli -c config.json retention set <remote-blob> --until <time> [--mode unlocked|locked] [--override-unlocked]
+
+# Print, replace or clear the lifecycle rules of the bucket. Rules use the
+# JSON format of the GCS JSON API, e.g.
+#   {"rule": [{"action": {"type": "Delete"},
+#              "condition": {"isLive": false, "daysSinceNoncurrentTime": 30}}]}
+# and are validated before being applied.
+bosh-gcscli -c config.json bucket lifecycle get
+bosh-gcscli -c config.json bucket lifecycle set <path/to/lifecycle.json>
+bosh-gcscli -c config.json bucket lifecycle clear
+
+# Create the bucket, or with ensure, create it if missing and otherwise
+# update the settings given, idempotently. Delete the bucket, with
+# --force emptying it first, succeeding if it does not exist.
+# Where:
+# - --project defaults to the project of the credentials, then to
+#   $GOOGLE_CLOUD_PROJECT
+# - --location defaults to 'US' when creating the bucket
+# - --storage-class defaults to storage_class in the config
+bosh-gcscli -c config.json [-output json] bucket (create | ensure) [--project <id>] [--location <location>]
+  [--storage-class <class>] [--uniform-access] [--versioning] [--public-read]
+bosh-gcscli -c config.json [-output json] bucket delete [--force]
 
 # Generate a signed url for an object
 # if an encryption key is present in config, the appropriate header will be sent
@@ -57,12 +110,58 @@ bosh-gcscli -c config.json exists <remote-blob>
 # - <http action> is GET, PUT, or DELETE
 # - <expiry> is a duration string less than 7 days (e.g. "6h")
 # eg bosh-gcscli -c config.json sign blobid PUT 24h
-bosh-gcscli -c config.json sign <remote-blob> <http action> <expiry>`
+bosh-gcscli -c config.json sign <remote-blob> <http action> <expiry>
+
+# Keep a client warm and serve operations over a Unix socket.
+# Invocations with -socket or $BOSH_GCSCLI_SOCKET pointing at the socket
+# forward their operation to the daemon if it serves the same config.
+bosh-gcscli -c config.json serve --socket <path/to/socket>
+
+# Execute the NDJSON operations of a manifest, or of stdin, concurrently.
+# Each line is one of:
+#   {"op": "put", "src": "<path/to/file>", "dst": "<remote-blob>"}
+#   {"op": "get", "src": "<remote-blob>", "dst": "<path/to/file>"}
+#   {"op": "copy", "src": "<remote-blob>", "dst": "<remote-blob>"}
+#   {"op": "delete", "blob": "<remote-blob>"}
+#   {"op": "exists", "blob": "<remote-blob>"}
+# One NDJSON result with status, error_code and duration_ms is printed
+# per operation.
+bosh-gcscli -c config.json batch [--parallelism <n>] [<path/to/manifest>]
+
+# Mirror a local directory to the blobs below a prefix, or the blobs
+# below a prefix to a local directory. Only files differing in size or
+# checksum are transferred.
+# Where:
+# - --upload mirrors <local-dir>, which must exist, to <prefix>
+# - --download mirrors <prefix> to <local-dir>, creating it if needed
+# - --delete removes files or blobs absent from the source
+# - --dry-run prints the NDJSON plan without performing it
+bosh-gcscli -c config.json sync --upload [--delete] [--dry-run] [--parallelism <n>] <local-dir> <prefix>
+bosh-gcscli -c config.json sync --download [--delete] [--dry-run] [--parallelism <n>] <prefix> <local-dir>
+
+# Compare the blobs below the optional prefix in the primary and
+# secondary bucket, printing one NDJSON line per blob missing from either
+# or differing. Exits non-zero if any does.
+bosh-gcscli -c config.json replicate verify [<prefix>]
+
+# Verify the config, credentials, bucket permissions needed by each
+# command and, unless read-only, write and delete a canary object.
+# Exits non-zero if any check failed.
+bosh-gcscli -c config.json [-output json] doctor`
 
 var (
 	showVer    = flag.Bool("v", false, "Print CLI version")
 	shortHelp  = flag.Bool("h", false, "Print this help text")
 	longHelp   = flag.Bool("help", false, "Print this help text")
+	socketPath = flag.String("socket", os.Getenv(daemon.SocketEnv),
+		"path of the socket of a running daemon to forward operations to\n(optional, defaults to $"+daemon.SocketEnv+")")
+	readOnly  = flag.Bool("read-only", false, "refuse every mutating operation, as with read_only in the config")
+	limitRate = flag.String("limit-rate", "",
+		"bytes per second to which uploads and downloads are limited, e.g. '10MiB',\nas with max_bandwidth in the config")
+	profileName = flag.String("profile", "",
+		"profile to use from a multi-profile config\n(optional, defaults to $"+config.ProfileEnv+" or the config's default)")
+	outputFormat = flag.String("output", outputText,
+		"format of the output of doctor, put, get, exists, stat and bucket, 'text' or 'json'\n(optional, defaults to 'text')")
 	configPath = flag.String("c", "",
 		`path to a JSON file with the following contents:
 	{
@@ -72,11 +171,98 @@ var (
 		                        (can be 'none' for explicitly no credentials)"
 		"json_key":            "JSON Service Account File
 		                        (optional, required for 'static' credentials)",
+		"json_key_path":       "path of a JSON Service Account File used
+		                        instead of json_key (optional)",
 		"storage_class":       "storage class for objects
 		                        (optional, defaults to bucket settings)",
 		"encryption_key":      "Base64 encoded 32 byte Customer-Supplied
 		                        encryption key used to encrypt objects
-								(optional, defaults to GCS controlled key)"
+								(optional, defaults to GCS controlled key)",
+		"encryption_key_file": "path of a file containing encryption_key
+		                        (optional)",
+		"client_encryption_key": "Base64 encoded 32 byte key with which blobs
+		                        are encrypted before upload (optional)",
+		"client_encryption_key_file": "path of a file containing
+		                        client_encryption_key (optional)",
+		"http_proxy":          "URL of a proxy for all GCS and token requests
+		                        (optional, defaults to the environment)",
+		"ca_cert":             "PEM encoded certificate authorities trusted
+		                        in addition to the system pool (optional)",
+		"client_cert":         "PEM encoded client certificate for mutual TLS
+		                        (optional, requires client_key)",
+		"client_key":          "PEM encoded private key of client_cert
+		                        (optional)",
+		"transport":           "API used to talk to GCS, 'http' or 'grpc'
+		                        (optional, defaults to 'http')",
+		"folder":              "prefix prepended to every blob ID, allowing
+		                        directors to share a bucket (optional)",
+		"remote_validation":   "check of the bucket before the first upload,
+		                        'bucket', 'object-probe' or 'skip'
+		                        (optional, defaults to 'bucket')",
+		"remote_validation_ttl": "duration, e.g. '1h', for which a successful
+		                        validation is reused by later invocations
+		                        (optional, defaults to validating every time)",
+		"read_strategy":       "clients used by get and exists, 'public-first',
+		                        'authenticated-only' or 'public-only'
+		                        (optional, defaults to 'public-first')",
+		"read_only":           "true to refuse every mutating operation and
+		                        signing PUT or DELETE urls, like -read-only
+		                        (optional, defaults to false)",
+		"compression":         "'gzip' or 'zstd' to compress every blob before
+		                        upload (optional, defaults to no compression)",
+		"max_bandwidth":       "bytes per second shared by all transfers of
+		                        the process, e.g. '10MiB', like -limit-rate
+		                        (optional, defaults to unlimited)",
+		"telemetry_exporter":  "'otlp' to export traces and metrics to the
+		                        endpoint of $OTEL_EXPORTER_OTLP_ENDPOINT, or
+		                        'file' to append them to telemetry_file
+		                        (optional, defaults to no telemetry)",
+		"telemetry_file":      "path of the file of the 'file' exporter
+		                        (optional)",
+		"audit_log":           "path of a file to which put, delete, copy,
+		                        sign and bucket delete append a JSON record
+		                        (optional, defaults to no audit log)",
+		"skip_if_identical":   "true for put, batch and sync to skip blobs the
+		                        bucket already holds, as with put
+		                        --skip-if-identical
+		                        (optional)",
+		"secondary":           {
+		  "bucket_name":         "bucket to which put, copy and delete are
+		                          replicated, read if the primary fails",
+		  "credentials_source", "json_key", "json_key_path",
+		  "encryption_key", "encryption_key_file", "storage_class":
+		                         "as above, defaulting to the primary's"
+		                       } (optional),
+		"replication":         "'all' for put, copy and delete to wait for
+		                        both buckets, 'primary-then-async' to
+		                        replicate in the background
+		                        (optional, defaults to 'all')",
+		"cache_dir":           "directory where get caches blobs, shared by
+		                        the processes of a host, not supported with
+		                        encryption_key
+		                        (optional, defaults to no cache)",
+		"cache_max_size":      "size beyond which least recently used blobs
+		                        are evicted, e.g. '20GiB'
+		                        (optional, defaults to '10GiB')",
+		"cache_immutable":     "true to serve cached blobs without checking
+		                        their generation (optional)"
+	}
+
+	The spans of an invocation are part of the trace given by the
+	TRACEPARENT and TRACESTATE environment variables, if set.
+
+	Any string value, also within secondary, may reference environment
+	variables as '${ENV_VAR}', or be read entirely from one as
+	'env:ENV_VAR'. Other fields may be given as such a string, e.g.
+	"read_only": "${READ_ONLY}", replaced by the JSON value of the
+	variable. Any field may be
+	overridden by an environment variable named after it, e.g.
+	BOSH_GCSCLI_BUCKET_NAME for bucket_name.
+
+	Several configurations can be kept in one file as profiles:
+	{
+		"default":  "name of the profile used without -profile (optional)",
+		"profiles": {"<name>": {<contents as above>}, ...}
 	}
 
 	storage_class is one of MULTI_REGIONAL, REGIONAL, NEARLINE, or COLDLINE.
@@ -88,6 +274,18 @@ var (
 `)
 )
 
+// commands are the commands parsing their own flags and arguments.
+var commands = map[string]func(ctx context.Context, cfg *config.GCSCli, args []string) error{
+	"serve":     runServe,
+	"batch":     runBatch,
+	"sync":      runSync,
+	"stat":      runStat,
+	"hold":      runHold,
+	"retention": runRetention,
+	"bucket":    runBucket,
+	"replicate": runReplicate,
+}
+
 func main() {
 	flag.Parse()
 
@@ -106,35 +304,82 @@ func main() {
 		log.Fatalf("no config file provided\nSee -help for usage\n")
 	}
 
-	configFile, err := os.Open(*configPath)
-	if err != nil {
-		log.Fatalf("opening config %s: %v\n", *configPath, err)
+	if *outputFormat != outputText && *outputFormat != outputJSON {
+		log.Fatalf("unknown output format: '%s'\n", *outputFormat)
+	}
+
+	ctx := context.Background()
+	if flag.Arg(0) == "doctor" {
+		// doctor reports an invalid config rather than failing on it
+		if err := runDoctor(ctx, flag.Args()[1:]); err != nil {
+			log.Fatalf("performing operation doctor: %s\n", err)
+		}
+		return
 	}
 
-	gcsConfig, err := config.NewFromReader(configFile)
+	gcsConfig, err := readConfig()
 	if err != nil {
-		log.Fatalf("reading config %s: %v\n", *configPath, err)
+		log.Fatalln(err)
 	}
+	ctx = setupTelemetry(ctx, &gcsConfig)
 
-	ctx := context.Background()
-	blobstoreClient, err := client.New(ctx, &gcsConfig)
+	nonFlagArgs := flag.Args()
+	cmd := nonFlagArgs[0]
+
+	run, ok := commands[cmd]
+	if cmd == "delete" && len(nonFlagArgs) > 1 && isBulkDeleteFlag(nonFlagArgs[1]) {
+		// delete with flags removes many blobs at once
+		run, ok = runBulkDelete, true
+	}
+	if ok {
+		err := run(ctx, &gcsConfig, nonFlagArgs[1:])
+		client.WaitReplication()
+		flushTelemetry()
+		if err != nil {
+			log.Fatalf("performing operation %s: %s\n", cmd, err)
+		}
+		return
+	}
+
+	blobstoreClient, err := newBlobstore(ctx, &gcsConfig)
 	if err != nil {
 		log.Fatalf("creating gcs client: %v\n", err)
 	}
 
-	nonFlagArgs := flag.Args()
 	if len(nonFlagArgs) < 2 {
 		log.Fatalf("Expected at least two arguments got %d\n", len(nonFlagArgs))
 	}
 
-	cmd := nonFlagArgs[0]
-
 	switch cmd {
 	case "put":
-		if len(nonFlagArgs) != 3 {
-			log.Fatalf("put method expected 2 arguments got %d\n", len(nonFlagArgs))
+		putFlags := flag.NewFlagSet("put", flag.ExitOnError)
+		customTime := putFlags.String("custom-time", "", "RFC 3339 timestamp set as the custom time of the object")
+		compress := putFlags.Bool("compress", false, "compress the blob with the configured compression, gzip if none")
+		progress := putFlags.Bool("progress", false, "report the progress of the upload on stderr")
+		skipIfIdentical := putFlags.Bool("skip-if-identical", gcsConfig.SkipIfIdentical,
+			"skip the upload if the blob already holds the file, compared by size and checksum")
+		var args []string
+		if args, err = parseFlags(putFlags, nonFlagArgs[1:]); err != nil {
+			log.Fatalln(err)
+		}
+		if len(args) != 2 {
+			log.Fatalf("put method expected 2 arguments got %d\n", len(args))
 		}
-		src, dst := nonFlagArgs[1], nonFlagArgs[2]
+		src, dst := args[0], args[1]
+
+		var options client.PutOptions
+		if *customTime != "" {
+			if options.CustomTime, err = time.Parse(time.RFC3339, *customTime); err != nil {
+				log.Fatalf("Invalid custom time: %v", err)
+			}
+		}
+		if *compress {
+			options.Compression = gcsConfig.Compression
+			if options.Compression == "" {
+				options.Compression = config.GzipCompression
+			}
+		}
+		options.SkipIfIdentical = *skipIfIdentical
 
 		var sourceFile *os.File
 		sourceFile, err = os.Open(src)
@@ -143,13 +388,37 @@ func main() {
 		}
 
 		defer sourceFile.Close() //nolint:errcheck
-		err = blobstoreClient.Put(sourceFile, dst)
-		fmt.Println(err)
+		finishProgress := func() {}
+		if *progress {
+			finishProgress = reportProgress(blobstoreClient)
+		}
+		var skipped bool
+		if options == (client.PutOptions{}) {
+			err = blobstoreClient.Put(sourceFile, dst)
+		} else {
+			skipped, err = blobstoreClient.PutWithResult(sourceFile, dst, options)
+		}
+		finishProgress()
+		switch {
+		case *outputFormat == outputJSON:
+			writePutResult(dst, skipped, err)
+		case skipped:
+			fmt.Printf("Skipped upload of '%s', blob '%s' is identical\n", src, dst)
+		default:
+			fmt.Println(err)
+		}
 	case "get":
-		if len(nonFlagArgs) != 3 {
-			log.Fatalf("get method expected 2 arguments got %d\n", len(nonFlagArgs))
+		getFlags := flag.NewFlagSet("get", flag.ExitOnError)
+		raw := getFlags.Bool("raw", false, "write compressed blobs as stored instead of decompressing them")
+		progress := getFlags.Bool("progress", false, "report the progress of the download on stderr")
+		var args []string
+		if args, err = parseFlags(getFlags, nonFlagArgs[1:]); err != nil {
+			log.Fatalln(err)
 		}
-		src, dst := nonFlagArgs[1], nonFlagArgs[2]
+		if len(args) != 2 {
+			log.Fatalf("get method expected 2 arguments got %d\n", len(args))
+		}
+		src, dst := args[0], args[1]
 
 		var dstFile *os.File
 		dstFile, err = os.Create(dst)
@@ -158,8 +427,25 @@ func main() {
 		}
 
 		defer dstFile.Close() //nolint:errcheck
-		err = blobstoreClient.Get(src, dstFile)
+		var readPath string
+		finishProgress := func() {}
+		if *progress {
+			finishProgress = reportProgress(blobstoreClient)
+		}
+		if *raw {
+			readPath, err = blobstoreClient.GetWithOptions(src, dstFile, client.GetOptions{Raw: true})
+		} else {
+			readPath, err = blobstoreClient.GetWithReadPath(src, dstFile)
+		}
+		finishProgress()
+		if *outputFormat == outputJSON {
+			writeReadResult(cmd, src, nil, readPath, err)
+		}
 	case "delete":
+		if len(nonFlagArgs) == 3 && nonFlagArgs[1] == "--" {
+			// -- precedes a blob whose name starts with '-'
+			nonFlagArgs = append(nonFlagArgs[:1], nonFlagArgs[2])
+		}
 		if len(nonFlagArgs) != 2 {
 			log.Fatalf("delete method expected 2 arguments got %d\n", len(nonFlagArgs))
 		}
@@ -171,11 +457,17 @@ func main() {
 		}
 
 		var exists bool
-		exists, err = blobstoreClient.Exists(nonFlagArgs[1])
+		var readPath string
+		exists, readPath, err = blobstoreClient.ExistsWithReadPath(nonFlagArgs[1])
+		if *outputFormat == outputJSON {
+			writeReadResult(cmd, nonFlagArgs[1], &exists, readPath, err)
+		}
 
 		// If the object exists the exit status is 0, otherwise it is 3
 		// We are using `3` since `1` and `2` have special meanings
 		if err == nil && !exists {
+			client.WaitReplication()
+			flushTelemetry()
 			os.Exit(3)
 		}
 	case "sign":
@@ -206,11 +498,82 @@ func main() {
 		log.Fatalf("unknown command: '%s'\n", cmd)
 	}
 
+	client.WaitReplication()
+	flushTelemetry()
 	if err != nil {
 		log.Fatalf("performing operation %s: %s\n", cmd, err)
 	}
 }
 
+// readConfig reads the profile selected by -profile or $BOSH_GCSCLI_PROFILE
+// from the config file given with -c, made read-only by -read-only and
+// limited by -limit-rate.
+func readConfig() (config.GCSCli, error) {
+	configFile, err := os.Open(*configPath)
+	if err != nil {
+		return config.GCSCli{}, fmt.Errorf("opening config %s: %v", *configPath, err)
+	}
+	defer configFile.Close() //nolint:errcheck
+
+	gcsConfig, err := config.NewFromReaderWithProfile(configFile, *profileName)
+	if err != nil {
+		return config.GCSCli{}, fmt.Errorf("reading config %s: %v", *configPath, err)
+	}
+	if *readOnly {
+		gcsConfig.ReadOnly = true
+	}
+	if *limitRate != "" {
+		if _, err := config.ParseBandwidth(*limitRate); err != nil {
+			return config.GCSCli{}, fmt.Errorf("invalid -limit-rate: %v", err)
+		}
+		gcsConfig.MaxBandwidth = *limitRate
+	}
+	return gcsConfig, nil
+}
+
+// blobstore is implemented by both the in-process and the daemon client.
+type blobstore interface {
+	daemon.Blobstore
+	daemon.OptionsPutter
+	daemon.PutResultReporter
+	daemon.OptionsGetter
+	daemon.ReadPathReporter
+}
+
+// newBlobstore returns a client forwarding operations to the daemon
+// listening on -socket if it serves cfg, or an in-process client otherwise.
+func newBlobstore(ctx context.Context, cfg *config.GCSCli) (blobstore, error) {
+	if *socketPath != "" {
+		daemonClient, err := daemon.Dial(*socketPath, cfg)
+		if err == nil {
+			return daemonClient, nil
+		}
+		log.Printf("not using daemon at %s: %v\n", *socketPath, err)
+	}
+
+	blobstoreClient, err := client.New(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return blobstoreClient, nil
+}
+
+// parseFlags parses args with flags, also accepting flags after positional
+// arguments, and returns the positional arguments.
+func parseFlags(flags *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		if flags.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+}
+
 func validateAction(action string) error {
 	if action != http.MethodGet && action != http.MethodPut && action != http.MethodDelete {
 		return fmt.Errorf("invalid signing action: %s must be GET, PUT, or DELETE", action)
@@ -0,0 +1,70 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+)
+
+// Formats of the output selected with -output.
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// readResult is the JSON output of get and exists, and of put.
+type readResult struct {
+	Op        string `json:"op"`
+	Blob      string `json:"blob"`
+	Status    string `json:"status"`
+	Exists    *bool  `json:"exists,omitempty"`
+	ReadPath  string `json:"read_path,omitempty"`
+	ErrorCode string `json:"error_code,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// writeReadResult prints the outcome of the read op of blob as JSON.
+func writeReadResult(op, blob string, exists *bool, readPath string, err error) {
+	result := readResult{Op: op, Blob: blob, Status: statusOK, Exists: exists, ReadPath: readPath}
+	if err != nil {
+		result.Status = statusFailed
+		result.Exists = nil
+		result.ErrorCode = errorCode(err)
+		result.Error = err.Error()
+	}
+	if err := json.NewEncoder(os.Stdout).Encode(result); err != nil {
+		log.Printf("writing result: %v\n", err)
+	}
+}
+
+// writePutResult prints the outcome of the put of blob as JSON.
+func writePutResult(blob string, skipped bool, err error) {
+	result := readResult{Op: "put", Blob: blob, Status: statusOK}
+	switch {
+	case err != nil:
+		result.Status = statusFailed
+		result.ErrorCode = errorCode(err)
+		result.Error = err.Error()
+	case skipped:
+		result.Status = statusSkipped
+	}
+	if err := json.NewEncoder(os.Stdout).Encode(result); err != nil {
+		log.Printf("writing result: %v\n", err)
+	}
+}
@@ -0,0 +1,188 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry/bosh-gcscli/client"
+)
+
+// progressReporter is implemented by a blobstore reporting the progress
+// of its transfers.
+type progressReporter interface {
+	SetProgress(report client.ProgressFunc)
+}
+
+// Intervals between progress updates on a terminal and as NDJSON events.
+const (
+	progressBarInterval   = 200 * time.Millisecond
+	progressEventInterval = time.Second
+)
+
+// progressBarWidth is the number of characters of the progress bar.
+const progressBarWidth = 30
+
+// progressEvent is an NDJSON progress update.
+type progressEvent struct {
+	Event          string `json:"event"`
+	Op             string `json:"op"`
+	Blob           string `json:"blob"`
+	Bytes          int64  `json:"bytes"`
+	Total          int64  `json:"total,omitempty"`
+	BytesPerSecond int64  `json:"bytes_per_second"`
+	ETASeconds     int64  `json:"eta_seconds,omitempty"`
+	Done           bool   `json:"done,omitempty"`
+}
+
+// progressPrinter prints the progress of a transfer to stderr, as a bar
+// on a terminal and as NDJSON events otherwise.
+type progressPrinter struct {
+	out      io.Writer
+	bar      bool
+	interval time.Duration
+
+	mu      sync.Mutex
+	start   time.Time
+	printed time.Time
+	latest  client.Progress
+}
+
+// newProgressPrinter returns a printer of progress to stderr, printing
+// NDJSON events if asJSON is set or stderr is not a terminal.
+func newProgressPrinter(asJSON bool) *progressPrinter {
+	bar := !asJSON && isTerminal(os.Stderr)
+	interval := progressEventInterval
+	if bar {
+		interval = progressBarInterval
+	}
+	return &progressPrinter{out: os.Stderr, bar: bar, interval: interval, start: time.Now()}
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// report records progress, printing it if the interval has elapsed since
+// the last update.
+func (p *progressPrinter) report(progress client.Progress) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.latest = progress
+	if now := time.Now(); now.Sub(p.printed) >= p.interval {
+		p.printed = now
+		p.print(false)
+	}
+}
+
+// finish prints the final progress of the transfer.
+func (p *progressPrinter) finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.latest.Op != "" {
+		p.print(true)
+	}
+}
+
+func (p *progressPrinter) print(done bool) {
+	elapsed := time.Since(p.start).Seconds()
+	var rate, eta float64
+	if elapsed > 0 {
+		rate = float64(p.latest.Transferred) / elapsed
+	}
+	if rate > 0 && p.latest.Total > p.latest.Transferred {
+		eta = float64(p.latest.Total-p.latest.Transferred) / rate
+	}
+
+	if !p.bar {
+		event := progressEvent{
+			Event:          "progress",
+			Op:             p.latest.Op,
+			Blob:           p.latest.Blob,
+			Bytes:          p.latest.Transferred,
+			BytesPerSecond: int64(rate),
+			ETASeconds:     int64(math.Ceil(eta)),
+			Done:           done,
+		}
+		if p.latest.Total >= 0 {
+			event.Total = p.latest.Total
+		}
+		if err := json.NewEncoder(p.out).Encode(event); err != nil {
+			log.Printf("writing progress: %v\n", err)
+		}
+		return
+	}
+
+	line := fmt.Sprintf("%s %s", formatBytes(float64(p.latest.Transferred)), p.latest.Blob)
+	if p.latest.Total > 0 {
+		filled := int(progressBarWidth * p.latest.Transferred / p.latest.Total)
+		filled = max(0, min(filled, progressBarWidth))
+		line = fmt.Sprintf("[%s%s] %3d%% %s / %s",
+			strings.Repeat("=", filled), strings.Repeat(" ", progressBarWidth-filled),
+			100*p.latest.Transferred/p.latest.Total,
+			formatBytes(float64(p.latest.Transferred)), formatBytes(float64(p.latest.Total)))
+	}
+	line += fmt.Sprintf(" %s/s", formatBytes(rate))
+	if eta > 0 {
+		line += fmt.Sprintf(" ETA %s", (time.Duration(eta) * time.Second).Round(time.Second))
+	}
+
+	// \r returns to the start of the line and \x1b[K clears its remainder
+	fmt.Fprintf(p.out, "\r%s\x1b[K", line) //nolint:errcheck
+	if done {
+		fmt.Fprintln(p.out) //nolint:errcheck
+	}
+}
+
+// formatBytes formats a number of bytes with a binary unit.
+func formatBytes(n float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	i := 0
+	for n >= 1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f %s", n, units[i])
+	}
+	return fmt.Sprintf("%.1f %s", n, units[i])
+}
+
+// reportProgress makes blobstoreClient report the progress of its
+// transfers to stderr, returning a function printing the final progress.
+func reportProgress(blobstoreClient blobstore) func() {
+	reporter, ok := blobstoreClient.(progressReporter)
+	if !ok {
+		log.Println("progress is not reported for operations forwarded to the daemon")
+		return func() {}
+	}
+
+	printer := newProgressPrinter(*outputFormat == outputJSON)
+	reporter.SetProgress(printer.report)
+	return printer.finish
+}
@@ -0,0 +1,76 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/cloudfoundry/bosh-gcscli/client"
+	"github.com/cloudfoundry/bosh-gcscli/config"
+)
+
+// runReplicate performs the replication operation named by args[0].
+func runReplicate(ctx context.Context, cfg *config.GCSCli, args []string) error {
+	if len(args) == 0 {
+		return errors.New("replicate expected an operation")
+	}
+
+	switch args[0] {
+	case "verify":
+		return runReplicateVerify(ctx, cfg, args[1:])
+	default:
+		return fmt.Errorf("unknown replicate operation: '%s'", args[0])
+	}
+}
+
+// runReplicateVerify prints one NDJSON line per blob below the optional
+// prefix whose replicas in the primary and secondary bucket differ, and
+// fails if any does.
+func runReplicateVerify(ctx context.Context, cfg *config.GCSCli, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("replicate verify expected at most 1 prefix got %d", len(args))
+	}
+	prefix := ""
+	if len(args) == 1 {
+		prefix = args[0]
+	}
+
+	blobstoreClient, err := client.New(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("creating gcs client: %v", err)
+	}
+
+	divergences, total, err := blobstoreClient.VerifyReplication(prefix)
+	if err != nil {
+		return err
+	}
+
+	output := json.NewEncoder(os.Stdout)
+	for _, divergence := range divergences {
+		if err := output.Encode(divergence); err != nil {
+			return fmt.Errorf("writing results: %v", err)
+		}
+	}
+	if len(divergences) > 0 {
+		return fmt.Errorf("%d of %d blobs diverge", len(divergences), total)
+	}
+	return nil
+}
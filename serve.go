@@ -0,0 +1,80 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/cloudfoundry/bosh-gcscli/client"
+	"github.com/cloudfoundry/bosh-gcscli/config"
+	"github.com/cloudfoundry/bosh-gcscli/daemon"
+)
+
+// runServe keeps a client configured by cfg warm and serves operations
+// on a Unix socket until interrupted.
+func runServe(ctx context.Context, cfg *config.GCSCli, args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	socket := flags.String("socket", os.Getenv(daemon.SocketEnv),
+		"path of the Unix socket to listen on (defaults to $"+daemon.SocketEnv+")")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *socket == "" {
+		return errors.New("serve expects --socket or $" + daemon.SocketEnv)
+	}
+
+	blobstoreClient, err := client.New(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("creating gcs client: %v", err)
+	}
+
+	server, err := daemon.NewServer(blobstoreClient, cfg)
+	if err != nil {
+		return err
+	}
+
+	// A socket left behind by a daemon which did not shut down cleanly
+	// is replaced, a socket of a running daemon is not.
+	if conn, err := net.Dial("unix", *socket); err == nil {
+		conn.Close() //nolint:errcheck
+		return fmt.Errorf("a daemon is already listening on %s", *socket)
+	}
+	os.Remove(*socket) //nolint:errcheck
+
+	listener, err := listenUnix(*socket)
+	if err != nil {
+		return err
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		listener.Close() //nolint:errcheck
+	}()
+
+	log.Printf("serving bucket '%s' on %s\n", cfg.BucketName, *socket)
+	return server.Serve(listener)
+}
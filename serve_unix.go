@@ -0,0 +1,34 @@
+//go:build !windows
+
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"net"
+	"syscall"
+)
+
+// listenUnix listens on a Unix socket at path which only the current user
+// can connect to. The umask is restricted while the socket is created, so
+// that it is never accessible to others.
+func listenUnix(path string) (net.Listener, error) {
+	umask := syscall.Umask(0o077)
+	defer syscall.Umask(umask)
+
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,29 @@
+//go:build windows
+
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"net"
+)
+
+// listenUnix listens on a Unix socket at path. Windows does not apply
+// a umask, access to the socket follows the ACL of its directory.
+func listenUnix(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
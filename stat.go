@@ -0,0 +1,138 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"cloud.google.com/go/storage"
+
+	"github.com/cloudfoundry/bosh-gcscli/client"
+	"github.com/cloudfoundry/bosh-gcscli/config"
+)
+
+// statResult is the metadata of a blob printed by stat.
+type statResult struct {
+	Blob                    string     `json:"blob"`
+	Size                    int64      `json:"size"`
+	CRC32C                  string     `json:"crc32c,omitempty"`
+	MD5                     string     `json:"md5,omitempty"`
+	Generation              int64      `json:"generation"`
+	StorageClass            string     `json:"storage_class"`
+	ContentType             string     `json:"content_type,omitempty"`
+	Updated                 time.Time  `json:"updated"`
+	CustomTime              *time.Time `json:"custom_time,omitempty"`
+	TemporaryHold           bool       `json:"temporary_hold"`
+	EventBasedHold          bool       `json:"event_based_hold"`
+	RetentionMode           string     `json:"retention_mode,omitempty"`
+	RetainUntil             *time.Time `json:"retain_until,omitempty"`
+	RetentionExpirationTime *time.Time `json:"retention_expiration_time,omitempty"`
+}
+
+// runStat prints the metadata of a blob, including its holds and retention.
+func runStat(ctx context.Context, cfg *config.GCSCli, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("stat expected 1 blob got %d", len(args))
+	}
+
+	blobstoreClient, err := client.New(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("creating gcs client: %v", err)
+	}
+
+	attrs, err := blobstoreClient.Stat(args[0])
+	if err != nil {
+		return err
+	}
+	result := newStatResult(args[0], attrs)
+
+	if *outputFormat == outputJSON {
+		return json.NewEncoder(os.Stdout).Encode(result)
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, field := range [][2]string{
+		{"blob", result.Blob},
+		{"size", strconv.FormatInt(result.Size, 10)},
+		{"crc32c", result.CRC32C},
+		{"md5", result.MD5},
+		{"generation", strconv.FormatInt(result.Generation, 10)},
+		{"storage_class", result.StorageClass},
+		{"content_type", result.ContentType},
+		{"updated", formatTime(&result.Updated)},
+		{"custom_time", formatTime(result.CustomTime)},
+		{"temporary_hold", strconv.FormatBool(result.TemporaryHold)},
+		{"event_based_hold", strconv.FormatBool(result.EventBasedHold)},
+		{"retention_mode", result.RetentionMode},
+		{"retain_until", formatTime(result.RetainUntil)},
+		{"retention_expiration_time", formatTime(result.RetentionExpirationTime)},
+	} {
+		if field[1] != "" {
+			fmt.Fprintf(writer, "%s\t%s\n", field[0], field[1]) //nolint:errcheck
+		}
+	}
+	return writer.Flush()
+}
+
+// newStatResult returns the metadata of the blob stored in attrs.
+func newStatResult(blob string, attrs *storage.ObjectAttrs) statResult {
+	result := statResult{
+		Blob:           blob,
+		Size:           attrs.Size,
+		MD5:            hex.EncodeToString(attrs.MD5),
+		Generation:     attrs.Generation,
+		StorageClass:   attrs.StorageClass,
+		ContentType:    attrs.ContentType,
+		Updated:        attrs.Updated,
+		CustomTime:     optionalTime(attrs.CustomTime),
+		TemporaryHold:  attrs.TemporaryHold,
+		EventBasedHold: attrs.EventBasedHold,
+
+		RetentionExpirationTime: optionalTime(attrs.RetentionExpirationTime),
+	}
+	if attrs.CRC32C != 0 {
+		result.CRC32C = fmt.Sprintf("%08x", attrs.CRC32C)
+	}
+	if attrs.Retention != nil {
+		result.RetentionMode = attrs.Retention.Mode
+		result.RetainUntil = optionalTime(attrs.Retention.RetainUntil)
+	}
+	return result
+}
+
+// optionalTime returns nil for the zero time, a pointer to t otherwise.
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// formatTime formats t as RFC 3339, or returns "" if t is nil.
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,421 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"math/rand/v2"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/cloudfoundry/bosh-gcscli/client"
+	"github.com/cloudfoundry/bosh-gcscli/config"
+)
+
+// syncAction is a single step of a sync plan and, once executed, its result.
+type syncAction struct {
+	// Action is one of upload, download or delete.
+	Action string `json:"action"`
+	// Path is the local file affected by the action.
+	Path string `json:"path,omitempty"`
+	// Object is the blob affected by the action.
+	Object string `json:"object,omitempty"`
+	// Reason is why the action is needed: missing, size, checksum or extraneous.
+	Reason string `json:"reason"`
+	Size   int64  `json:"size"`
+
+	Status     string `json:"status,omitempty"`
+	ErrorCode  string `json:"error_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms,omitempty"`
+}
+
+// localFile is a regular file below a synced directory.
+type localFile struct {
+	path string
+	size int64
+}
+
+// runSync mirrors a local directory to a blob prefix with --upload, or a
+// blob prefix to a local directory with --download, transferring only the
+// files which differ.
+func runSync(ctx context.Context, cfg *config.GCSCli, args []string) error {
+	flags := flag.NewFlagSet("sync", flag.ExitOnError)
+	upload := flags.Bool("upload", false, "mirror <local-dir> to the blobs below <prefix>")
+	download := flags.Bool("download", false, "mirror the blobs below <prefix> to <local-dir>")
+	parallelism := flags.Int("parallelism", 8, "maximum number of concurrent transfers")
+	deleteExtraneous := flags.Bool("delete", false, "delete files or blobs absent from the source")
+	dryRun := flags.Bool("dry-run", false, "print the NDJSON plan without performing it")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		return fmt.Errorf("sync expected 2 arguments got %d", flags.NArg())
+	}
+	if *parallelism < 1 {
+		return errors.New("--parallelism must be at least 1")
+	}
+
+	if *upload == *download {
+		return errors.New("sync expected exactly one of --upload or --download")
+	}
+
+	src, dst := flags.Arg(0), flags.Arg(1)
+	if *upload && !isDir(src) {
+		return fmt.Errorf("'%s' is not a local directory", src)
+	}
+	if *download {
+		if _, err := os.Stat(dst); err == nil && !isDir(dst) {
+			return fmt.Errorf("'%s' is not a local directory", dst)
+		}
+	}
+
+	blobstoreClient, err := client.New(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("creating gcs client: %v", err)
+	}
+
+	var plan []syncAction
+	if *upload {
+		plan, err = planUpload(blobstoreClient, src, blobPrefix(dst), *deleteExtraneous)
+	} else {
+		plan, err = planDownload(blobstoreClient, blobPrefix(src), dst, *deleteExtraneous)
+	}
+	if err != nil {
+		return err
+	}
+
+	output := json.NewEncoder(os.Stdout)
+	if *dryRun {
+		for _, action := range plan {
+			if err := output.Encode(action); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var (
+		outputMu sync.Mutex
+		failed   int
+	)
+
+	group := new(errgroup.Group)
+	group.SetLimit(*parallelism)
+	for _, action := range plan {
+		group.Go(func() error {
+			start := time.Now()
+			skipped, err := executeSyncAction(blobstoreClient, action, cfg.SkipIfIdentical)
+			action.DurationMS = time.Since(start).Milliseconds()
+			action.Status = statusOK
+			if skipped {
+				action.Status = statusSkipped
+			}
+
+			outputMu.Lock()
+			defer outputMu.Unlock()
+			if err != nil {
+				failed++
+				action.Status = statusFailed
+				action.ErrorCode = errorCode(err)
+				action.Error = err.Error()
+			}
+			return output.Encode(action)
+		})
+	}
+
+	if err := group.Wait(); err != nil {
+		return fmt.Errorf("writing results: %v", err)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d actions failed", failed, len(plan))
+	}
+	return nil
+}
+
+// planUpload returns the actions making the blobs below prefix mirror dir.
+func planUpload(blobstoreClient *client.GCSBlobstore, dir, prefix string, deleteExtraneous bool) ([]syncAction, error) {
+	local, err := listLocal(dir)
+	if err != nil {
+		return nil, err
+	}
+	remote, err := listRemote(blobstoreClient, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var plan []syncAction
+	for _, rel := range sortedKeys(local) {
+		file := local[rel]
+		object := prefix + rel
+
+		blob, ok := remote[object]
+		reason, err := compareSync(file.path, blob, ok)
+		if err != nil {
+			return nil, err
+		}
+		if reason != "" {
+			plan = append(plan, syncAction{Action: "upload", Path: file.path, Object: object, Reason: reason, Size: file.size})
+		}
+	}
+
+	if deleteExtraneous {
+		for _, object := range sortedKeys(remote) {
+			if _, ok := local[strings.TrimPrefix(object, prefix)]; !ok {
+				plan = append(plan, syncAction{Action: "delete", Object: object, Reason: "extraneous", Size: remote[object].Size})
+			}
+		}
+	}
+	return plan, nil
+}
+
+// planDownload returns the actions making dir mirror the blobs below prefix.
+func planDownload(blobstoreClient *client.GCSBlobstore, prefix, dir string, deleteExtraneous bool) ([]syncAction, error) {
+	remote, err := listRemote(blobstoreClient, prefix)
+	if err != nil {
+		return nil, err
+	}
+	local := map[string]localFile{}
+	if isDir(dir) {
+		if local, err = listLocal(dir); err != nil {
+			return nil, err
+		}
+	}
+
+	var plan []syncAction
+	for _, object := range sortedKeys(remote) {
+		rel := strings.TrimPrefix(object, prefix)
+		if !fs.ValidPath(rel) {
+			return nil, fmt.Errorf("blob '%s' cannot be stored below '%s'", object, dir)
+		}
+
+		p := filepath.Join(dir, filepath.FromSlash(rel))
+		blob := remote[object]
+		reason, err := compareSync(p, blob, true)
+		if err != nil {
+			return nil, err
+		}
+		if reason != "" {
+			plan = append(plan, syncAction{Action: "download", Path: p, Object: object, Reason: reason, Size: blob.Size})
+		}
+	}
+
+	if deleteExtraneous {
+		for _, rel := range sortedKeys(local) {
+			if _, ok := remote[prefix+rel]; !ok {
+				plan = append(plan, syncAction{Action: "delete", Path: local[rel].path, Reason: "extraneous", Size: local[rel].size})
+			}
+		}
+	}
+	return plan, nil
+}
+
+// compareSync returns why the local file at p and blob differ, or an empty
+// string if they have identical content.
+//
+// Compressed and client-side encrypted blobs are compared by the size and
+// CRC32C of the blob uploaded, as their stored bytes differ from the file.
+func compareSync(p string, blob client.BlobInfo, blobExists bool) (string, error) {
+	info, err := os.Stat(p)
+	if errors.Is(err, fs.ErrNotExist) || !blobExists {
+		return "missing", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	size := blob.Size
+	if blob.SourceRecorded {
+		size = blob.SourceSize
+	}
+	if info.Size() != size {
+		return "size", nil
+	}
+
+	crc, md5sum, err := fileChecksums(p)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case blob.SourceRecorded:
+		if crc != blob.SourceCRC32C {
+			return "checksum", nil
+		}
+	case blob.CRC32C != 0 || len(blob.MD5) == 0:
+		// 0 is a valid CRC32C, and the only checksum of composite objects
+		if crc != blob.CRC32C {
+			return "checksum", nil
+		}
+	case !bytes.Equal(md5sum, blob.MD5):
+		return "checksum", nil
+	}
+	return "", nil
+}
+
+// executeSyncAction performs action, reporting whether an upload was
+// skipped as its blob is identical if skipIfIdentical.
+func executeSyncAction(blobstoreClient *client.GCSBlobstore, action syncAction, skipIfIdentical bool) (bool, error) {
+	switch {
+	case action.Action == "upload":
+		sourceFile, err := os.Open(action.Path)
+		if err != nil {
+			return false, err
+		}
+		defer sourceFile.Close() //nolint:errcheck
+		return blobstoreClient.PutWithResult(sourceFile, action.Object, client.PutOptions{SkipIfIdentical: skipIfIdentical})
+	case action.Action == "download":
+		if err := os.MkdirAll(filepath.Dir(action.Path), 0755); err != nil {
+			return false, err
+		}
+		return false, downloadFile(action.Path, func(w io.Writer) error {
+			return blobstoreClient.Get(action.Object, w)
+		})
+	case action.Action == "delete" && action.Object != "":
+		return false, blobstoreClient.Delete(action.Object)
+	case action.Action == "delete":
+		return false, os.Remove(action.Path)
+	}
+	return false, fmt.Errorf("unknown sync action '%s'", action.Action)
+}
+
+// downloadFile writes the blob fetched by download into a temporary file
+// next to dst and renames it once complete, so dst is never left partially
+// written.
+func downloadFile(dst string, download func(io.Writer) error) error {
+	tmpFile, err := createDownloadFile(dst)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name()) //nolint:errcheck
+
+	if err := download(tmpFile); err != nil {
+		tmpFile.Close() //nolint:errcheck
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), dst)
+}
+
+// createDownloadFile creates a new temporary file next to dst. Unlike
+// os.CreateTemp, its mode is that of os.Create, 0666 minus the umask, which
+// dst keeps once the file is renamed.
+func createDownloadFile(dst string) (*os.File, error) {
+	prefix := filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+".download")
+	for {
+		file, err := os.OpenFile(prefix+strconv.FormatUint(uint64(rand.Uint32()), 10), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o666)
+		if !errors.Is(err, fs.ErrExist) {
+			return file, err
+		}
+	}
+}
+
+// listLocal returns the regular files below dir keyed by their slash
+// separated path relative to dir.
+func listLocal(dir string) (map[string]localFile, error) {
+	files := map[string]localFile{}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = localFile{path: p, size: info.Size()}
+		return nil
+	})
+	return files, err
+}
+
+// listRemote returns the blobs below prefix keyed by name, omitting
+// placeholders for directories.
+func listRemote(blobstoreClient *client.GCSBlobstore, prefix string) (map[string]client.BlobInfo, error) {
+	blobs, err := blobstoreClient.List(prefix)
+	if err != nil {
+		return nil, fmt.Errorf("listing '%s': %v", prefix, err)
+	}
+
+	remote := map[string]client.BlobInfo{}
+	for _, blob := range blobs {
+		if !strings.HasSuffix(blob.Name, "/") {
+			remote[blob.Name] = blob
+		}
+	}
+	return remote, nil
+}
+
+// fileChecksums returns the CRC32C and MD5 checksums of the file at p.
+func fileChecksums(p string) (uint32, []byte, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer f.Close() //nolint:errcheck
+
+	crcHash := crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	md5Hash := md5.New()
+	if _, err := io.Copy(io.MultiWriter(crcHash, md5Hash), f); err != nil {
+		return 0, nil, err
+	}
+	return crcHash.Sum32(), md5Hash.Sum(nil), nil
+}
+
+// blobPrefix turns a sync argument into a prefix matching whole path
+// segments, e.g. 'releases' into 'releases/'.
+func blobPrefix(arg string) string {
+	arg = strings.TrimPrefix(path.Clean("/"+arg), "/")
+	if arg == "" {
+		return ""
+	}
+	return arg + "/"
+}
+
+func isDir(p string) bool {
+	info, err := os.Stat(p)
+	return err == nil && info.IsDir()
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
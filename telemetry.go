@@ -0,0 +1,51 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/cloudfoundry/bosh-gcscli/config"
+	"github.com/cloudfoundry/bosh-gcscli/telemetry"
+)
+
+// telemetryFlushTimeout bounds the time spent exporting telemetry on exit.
+const telemetryFlushTimeout = 5 * time.Second
+
+// flushTelemetry exports the telemetry recorded so far and stops recording
+// it. It must be called before exiting, as deferred calls do not run then.
+var flushTelemetry = func() {}
+
+// setupTelemetry installs the telemetry exporter configured by cfg and
+// returns ctx carrying the trace context of $TRACEPARENT, if set.
+func setupTelemetry(ctx context.Context, cfg *config.GCSCli) context.Context {
+	shutdown, err := telemetry.Setup(ctx, cfg, version)
+	if err != nil {
+		log.Fatalf("setting up telemetry: %v\n", err)
+	}
+
+	flushTelemetry = func() {
+		ctx, cancel := context.WithTimeout(context.Background(), telemetryFlushTimeout)
+		defer cancel()
+		if err := shutdown(ctx); err != nil {
+			log.Printf("exporting telemetry: %v\n", err)
+		}
+	}
+	return telemetry.FromEnvironment(ctx)
+}
@@ -0,0 +1,131 @@
+/*
+ * Copyright 2017 Google Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/cloudfoundry/bosh-gcscli/config"
+)
+
+// ServiceName is the name of the service reported with all telemetry.
+const ServiceName = "bosh-gcscli"
+
+// Environment variables carrying the trace context of the caller, in the
+// W3C Trace Context format.
+const (
+	TraceParentEnv = "TRACEPARENT"
+	TraceStateEnv  = "TRACESTATE"
+)
+
+// Setup installs the global tracer and meter providers exporting to the
+// telemetry_exporter of cfg. The returned function flushes and stops them,
+// and must be called before exiting.
+//
+// If cfg has no telemetry_exporter, nothing is installed and the
+// instrumentation of blobstore operations is a no-op.
+func Setup(ctx context.Context, cfg *config.GCSCli, version string) (func(context.Context) error, error) {
+	var spanExporter sdktrace.SpanExporter
+	var metricExporter sdkmetric.Exporter
+	var closer io.Closer
+
+	switch cfg.TelemetryExporter {
+	case "":
+		return func(context.Context) error { return nil }, nil
+	case config.OTLPTelemetryExporter:
+		var err error
+		if spanExporter, err = otlptracehttp.New(ctx); err != nil {
+			return nil, fmt.Errorf("creating OTLP trace exporter: %v", err)
+		}
+		if metricExporter, err = otlpmetrichttp.New(ctx); err != nil {
+			return nil, fmt.Errorf("creating OTLP metric exporter: %v", err)
+		}
+	case config.FileTelemetryExporter:
+		file, err := os.OpenFile(cfg.TelemetryFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("opening telemetry file: %v", err)
+		}
+		if spanExporter, err = stdouttrace.New(stdouttrace.WithWriter(file)); err != nil {
+			file.Close() //nolint:errcheck
+			return nil, fmt.Errorf("creating trace exporter: %v", err)
+		}
+		if metricExporter, err = stdoutmetric.New(stdoutmetric.WithWriter(file)); err != nil {
+			file.Close() //nolint:errcheck
+			return nil, fmt.Errorf("creating metric exporter: %v", err)
+		}
+		closer = file
+	default:
+		return nil, config.ErrUnknownTelemetryExporter
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", ServiceName),
+		attribute.String("service.version", version),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("creating telemetry resource: %v", err)
+	}
+
+	tracerProvider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithResource(res),
+	)
+	meterProvider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter)),
+		sdkmetric.WithResource(res),
+	)
+	otel.SetTracerProvider(tracerProvider)
+	otel.SetMeterProvider(meterProvider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	return func(ctx context.Context) error {
+		err := errors.Join(tracerProvider.Shutdown(ctx), meterProvider.Shutdown(ctx))
+		if closer != nil {
+			err = errors.Join(err, closer.Close())
+		}
+		return err
+	}, nil
+}
+
+// FromEnvironment returns ctx carrying the trace context of the
+// TRACEPARENT and TRACESTATE environment variables, if they are set, so
+// that the spans of the process are part of the caller's trace.
+func FromEnvironment(ctx context.Context) context.Context {
+	carrier := propagation.MapCarrier{}
+	if parent := os.Getenv(TraceParentEnv); parent != "" {
+		carrier["traceparent"] = parent
+	}
+	if state := os.Getenv(TraceStateEnv); state != "" {
+		carrier["tracestate"] = state
+	}
+	return propagation.TraceContext{}.Extract(ctx, carrier)
+}